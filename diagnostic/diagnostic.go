@@ -0,0 +1,184 @@
+package diagnostic
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nomad-software/script/token"
+)
+
+// Severity represents how serious a diagnostic is.
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+// String returns a string representation of a severity.
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	default:
+		return "unknown"
+	}
+}
+
+// Code identifies the kind of problem a diagnostic reports.
+type Code string
+
+// Parser codes
+const (
+	ExpectedExpression Code = "expected-expression"
+	ExpectedPattern    Code = "expected-pattern"
+	IllegalToken       Code = "illegal-token"
+	InvalidArgument    Code = "invalid-argument"
+	InvalidAssignment  Code = "invalid-assignment"
+	InvalidFloat       Code = "invalid-float"
+	InvalidInteger     Code = "invalid-integer"
+	InvalidParameter   Code = "invalid-parameter"
+	InvalidString      Code = "invalid-string"
+	MisplacedStatement Code = "misplaced-statement"
+	MissingInitializer Code = "missing-initializer"
+	UnexpectedToken    Code = "unexpected-token"
+)
+
+// Evaluator codes
+const (
+	RuntimeError Code = "runtime-error"
+)
+
+// Related is a secondary location which helps explain a diagnostic.
+type Related struct {
+	Span    token.Span
+	Message string
+}
+
+// Diagnostic is a positioned message about the source input.
+type Diagnostic struct {
+	Severity Severity
+	Code     Code
+	Message  string
+	Span     token.Span
+	Hints    []string
+	Related  []Related
+}
+
+// New creates a new error diagnostic.
+func New(code Code, span token.Span, format string, a ...interface{}) *Diagnostic {
+	return &Diagnostic{
+		Severity: Error,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+		Span:     span,
+	}
+}
+
+// WithHint adds a hint to the diagnostic.
+func (d *Diagnostic) WithHint(format string, a ...interface{}) *Diagnostic {
+	d.Hints = append(d.Hints, fmt.Sprintf(format, a...))
+	return d
+}
+
+// WithRelated adds a related location to the diagnostic.
+func (d *Diagnostic) WithRelated(span token.Span, format string, a ...interface{}) *Diagnostic {
+	d.Related = append(d.Related, Related{Span: span, Message: fmt.Sprintf(format, a...)})
+	return d
+}
+
+// Error returns the diagnostic as a single line, prefixed with its position.
+func (d *Diagnostic) Error() string {
+	return d.Span.Start.String() + ": " + d.Message
+}
+
+// String returns a string representation of a diagnostic.
+func (d *Diagnostic) String() string {
+	return d.Error()
+}
+
+// Render writes the diagnostics to w, showing the offending line of the
+// source underlined with carets.
+//
+//	error[unexpected-token]: Expected token ')', got ';' instead
+//	 --> 1:9
+//	  |
+//	1 | if (true; { 1 }
+//	  |         ^
+func Render(w io.Writer, source string, diagnostics ...*Diagnostic) {
+	for _, d := range diagnostics {
+		fmt.Fprintf(w, "%s[%s]: %s\n", d.Severity, d.Code, d.Message)
+		renderSpan(w, source, d.Span)
+
+		for _, hint := range d.Hints {
+			fmt.Fprintf(w, "  = hint: %s\n", hint)
+		}
+
+		for _, r := range d.Related {
+			fmt.Fprintf(w, "%s: %s\n", Note, r.Message)
+			renderSpan(w, source, r.Span)
+		}
+	}
+}
+
+func renderSpan(w io.Writer, source string, span token.Span) {
+	start := span.Start
+	fmt.Fprintf(w, " --> %s\n", start)
+
+	if !start.IsValid() {
+		return
+	}
+
+	lines := strings.Split(source, "\n")
+	if start.Line > len(lines) {
+		return
+	}
+
+	line := strings.TrimRight(lines[start.Line-1], "\r")
+	gutter := fmt.Sprintf("%d", start.Line)
+	margin := strings.Repeat(" ", len(gutter))
+
+	fmt.Fprintf(w, "%s |\n", margin)
+	fmt.Fprintf(w, "%s | %s\n", gutter, line)
+	fmt.Fprintf(w, "%s | %s\n", margin, underline(line, span))
+}
+
+func underline(line string, span token.Span) string {
+	var out strings.Builder
+
+	runes := []rune(line)
+	col := span.Start.Column - 1
+	if col > len(runes) {
+		col = len(runes)
+	}
+
+	// Keep tabs so the carets line up with the source.
+	for _, r := range runes[:col] {
+		if r == '\t' {
+			out.WriteRune('\t')
+		} else {
+			out.WriteRune(' ')
+		}
+	}
+
+	width := 1
+	if span.End.Line == span.Start.Line && span.End.Column > span.Start.Column {
+		width = span.End.Column - span.Start.Column
+	} else if span.End.Line > span.Start.Line {
+		width = utf8.RuneCountInString(line) - col
+	}
+	if width < 1 {
+		width = 1
+	}
+
+	out.WriteString(strings.Repeat("^", width))
+
+	return out.String()
+}
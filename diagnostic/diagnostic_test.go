@@ -0,0 +1,65 @@
+package diagnostic
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nomad-software/script/token"
+)
+
+func TestRender(t *testing.T) {
+	source := "let x = 1;\nlet y = x +\ttrue;"
+
+	d := New(RuntimeError, token.Span{
+		Start: token.Position{Offset: 19, Line: 2, Column: 9},
+		End:   token.Position{Offset: 29, Line: 2, Column: 18},
+	}, "invalid operation: %s + %s", "INTEGER", "BOOLEAN")
+
+	d.WithHint("convert the operands to the same type")
+
+	var out bytes.Buffer
+	Render(&out, source, d)
+
+	expected := "error[runtime-error]: invalid operation: INTEGER + BOOLEAN\n" +
+		" --> 2:9\n" +
+		"  |\n" +
+		"2 | let y = x +\ttrue;\n" +
+		"  |         ^^^^^^^^^\n" +
+		"  = hint: convert the operands to the same type\n"
+
+	if out.String() != expected {
+		t.Errorf("wrong rendering.\nwant=%q\ngot= %q", expected, out.String())
+	}
+}
+
+func TestRenderRelated(t *testing.T) {
+	source := "let x = (1 + 2;"
+
+	d := New(UnexpectedToken, token.Span{
+		Start: token.Position{Offset: 15, Line: 1, Column: 16},
+		End:   token.Position{Offset: 15, Line: 1, Column: 16},
+	}, "Expected token ')', got ';' instead")
+
+	d.WithRelated(token.Span{
+		Start: token.Position{Offset: 8, Line: 1, Column: 9},
+		End:   token.Position{Offset: 9, Line: 1, Column: 10},
+	}, "unclosed delimiter")
+
+	var out bytes.Buffer
+	Render(&out, source, d)
+
+	expected := "error[unexpected-token]: Expected token ')', got ';' instead\n" +
+		" --> 1:16\n" +
+		"  |\n" +
+		"1 | let x = (1 + 2;\n" +
+		"  |                ^\n" +
+		"note: unclosed delimiter\n" +
+		" --> 1:9\n" +
+		"  |\n" +
+		"1 | let x = (1 + 2;\n" +
+		"  |         ^\n"
+
+	if out.String() != expected {
+		t.Errorf("wrong rendering.\nwant=%q\ngot= %q", expected, out.String())
+	}
+}
@@ -0,0 +1,101 @@
+package evaluator
+
+import (
+	"math"
+	"math/big"
+
+	"github.com/nomad-software/script/object"
+	"github.com/nomad-software/script/token"
+)
+
+// maxIntegerBits is the size of the largest big integer an operation can
+// produce. Larger results are reported as an error, rather than exhausting the
+// memory of the host.
+const maxIntegerBits = 1 << 20
+
+// Results are demoted back to an Integer whenever they fit into one.
+func evalBigIntegerInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toBigInt(left)
+	rightVal := toBigInt(right)
+
+	switch operator {
+	case token.PLUS:
+		return object.NewInteger(new(big.Int).Add(leftVal, rightVal))
+	case token.MINUS:
+		return object.NewInteger(new(big.Int).Sub(leftVal, rightVal))
+	case token.ASTERISK:
+		if leftVal.BitLen()+rightVal.BitLen() > maxIntegerBits {
+			return newError("integer result too large")
+		}
+		return object.NewInteger(new(big.Int).Mul(leftVal, rightVal))
+	case token.SLASH:
+		if rightVal.Sign() == 0 {
+			return newError("division by zero")
+		}
+		return object.NewInteger(new(big.Int).Quo(leftVal, rightVal))
+	case token.PERCENT:
+		if rightVal.Sign() == 0 {
+			return newError("division by zero")
+		}
+		return object.NewInteger(new(big.Int).Rem(leftVal, rightVal))
+	case token.POWER:
+		if rightVal.Sign() < 0 {
+			return &object.Float{Value: math.Pow(toFloat(left), toFloat(right))}
+		}
+		if !rightVal.IsInt64() {
+			return newError("exponent too large: %s", rightVal)
+		}
+		// Powers of 0, 1 and -1 never grow.
+		if leftVal.CmpAbs(big.NewInt(1)) > 0 && rightVal.Int64() > int64(maxIntegerBits/leftVal.BitLen()) {
+			return newError("integer result too large")
+		}
+		return object.NewInteger(new(big.Int).Exp(leftVal, rightVal, nil))
+	case token.AMPERSAND:
+		return object.NewInteger(new(big.Int).And(leftVal, rightVal))
+	case token.PIPE:
+		return object.NewInteger(new(big.Int).Or(leftVal, rightVal))
+	case token.CARET:
+		return object.NewInteger(new(big.Int).Xor(leftVal, rightVal))
+	case token.AND_NOT:
+		return object.NewInteger(new(big.Int).AndNot(leftVal, rightVal))
+	case token.SHIFT_LEFT, token.SHIFT_RIGHT:
+		if rightVal.Sign() < 0 {
+			return newError("negative shift count: %s", rightVal)
+		}
+		if !rightVal.IsUint64() || rightVal.Uint64() > math.MaxUint32 {
+			return newError("shift count too large: %s", rightVal)
+		}
+		if operator == token.SHIFT_LEFT {
+			if leftVal.Sign() != 0 && uint64(leftVal.BitLen())+rightVal.Uint64() > maxIntegerBits {
+				return newError("integer result too large")
+			}
+			return object.NewInteger(new(big.Int).Lsh(leftVal, uint(rightVal.Uint64())))
+		}
+		return object.NewInteger(new(big.Int).Rsh(leftVal, uint(rightVal.Uint64())))
+	case token.LT:
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) < 0)
+	case token.LT_EQUAL:
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) <= 0)
+	case token.GT:
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) > 0)
+	case token.GT_EQUAL:
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) >= 0)
+	case token.EQUAL:
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) == 0)
+	case token.NOT_EQUAL:
+		return nativeBoolToBooleanObject(leftVal.Cmp(rightVal) != 0)
+	default:
+		return newError("invalid operation: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func toBigInt(obj object.Object) *big.Int {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return big.NewInt(obj.Value)
+	case *object.BigInt:
+		return obj.Value
+	default:
+		return new(big.Int)
+	}
+}
@@ -2,6 +2,10 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
 	"unicode/utf8"
 
 	"github.com/nomad-software/script/object"
@@ -10,7 +14,7 @@ import (
 var builtins = map[string]*object.Builtin{
 
 	"len": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(args []object.Object, named map[string]object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1", len(args))
 			}
@@ -18,6 +22,8 @@ var builtins = map[string]*object.Builtin{
 			switch arg := args[0].(type) {
 			case *object.Array:
 				return &object.Integer{Value: int64(len(arg.Elements))}
+			case *object.Hash:
+				return &object.Integer{Value: int64(arg.Len())}
 			case *object.String:
 				return &object.Integer{
 					Value: int64(utf8.RuneCountInString(arg.Value)),
@@ -29,7 +35,7 @@ var builtins = map[string]*object.Builtin{
 	},
 
 	"print": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(args []object.Object, named map[string]object.Object) object.Object {
 			for _, arg := range args {
 				fmt.Println(arg.Inspect())
 			}
@@ -38,7 +44,7 @@ var builtins = map[string]*object.Builtin{
 	},
 
 	"first": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(args []object.Object, named map[string]object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1", len(args))
 			}
@@ -56,7 +62,7 @@ var builtins = map[string]*object.Builtin{
 	},
 
 	"last": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(args []object.Object, named map[string]object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1", len(args))
 			}
@@ -75,7 +81,7 @@ var builtins = map[string]*object.Builtin{
 	},
 
 	"unshift": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(args []object.Object, named map[string]object.Object) object.Object {
 			if len(args) != 2 {
 				return newError("wrong number of arguments. got=%d, want=2", len(args))
 			}
@@ -91,7 +97,7 @@ var builtins = map[string]*object.Builtin{
 	},
 
 	"shift": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(args []object.Object, named map[string]object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1", len(args))
 			}
@@ -111,7 +117,7 @@ var builtins = map[string]*object.Builtin{
 	},
 
 	"push": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(args []object.Object, named map[string]object.Object) object.Object {
 			if len(args) != 2 {
 				return newError("wrong number of arguments. got=%d, want=2", len(args))
 			}
@@ -127,7 +133,7 @@ var builtins = map[string]*object.Builtin{
 	},
 
 	"pop": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(args []object.Object, named map[string]object.Object) object.Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1", len(args))
 			}
@@ -145,4 +151,224 @@ var builtins = map[string]*object.Builtin{
 			return arr
 		},
 	},
+
+	"keys": &object.Builtin{
+		Fn: func(args []object.Object, named map[string]object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if !args[0].IsType(object.HASH) {
+				return newError("argument to `keys` must be %s, got %s", object.HASH, args[0].Type())
+			}
+
+			hash := args[0].(*object.Hash)
+			keys := []object.Object{}
+
+			for _, pair := range hash.Pairs() {
+				keys = append(keys, pair.Key)
+			}
+
+			return &object.Array{Elements: keys}
+		},
+	},
+
+	"values": &object.Builtin{
+		Fn: func(args []object.Object, named map[string]object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if !args[0].IsType(object.HASH) {
+				return newError("argument to `values` must be %s, got %s", object.HASH, args[0].Type())
+			}
+
+			hash := args[0].(*object.Hash)
+			values := []object.Object{}
+
+			for _, pair := range hash.Pairs() {
+				values = append(values, pair.Value)
+			}
+
+			return &object.Array{Elements: values}
+		},
+	},
+
+	"has": &object.Builtin{
+		Fn: func(args []object.Object, named map[string]object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if !args[0].IsType(object.HASH) {
+				return newError("argument to `has` must be %s, got %s", object.HASH, args[0].Type())
+			}
+
+			key, ok := args[1].(object.Hashable)
+			if !ok {
+				return newError("unusable as hash key: %s", args[1].Type())
+			}
+
+			_, ok = args[0].(*object.Hash).Get(key)
+
+			return nativeBoolToBooleanObject(ok)
+		},
+	},
+
+	"delete": &object.Builtin{
+		Fn: func(args []object.Object, named map[string]object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if !args[0].IsType(object.HASH) {
+				return newError("argument to `delete` must be %s, got %s", object.HASH, args[0].Type())
+			}
+
+			key, ok := args[1].(object.Hashable)
+			if !ok {
+				return newError("unusable as hash key: %s", args[1].Type())
+			}
+
+			hash := args[0].(*object.Hash)
+			hash.Delete(key)
+
+			return hash
+		},
+	},
+
+	"merge": &object.Builtin{
+		Fn: func(args []object.Object, named map[string]object.Object) object.Object {
+			if len(args) < 2 {
+				return newError("wrong number of arguments. got=%d, want at least 2", len(args))
+			}
+
+			merged := object.NewHash()
+
+			for _, arg := range args {
+				if !arg.IsType(object.HASH) {
+					return newError("argument to `merge` must be %s, got %s", object.HASH, arg.Type())
+				}
+				for _, pair := range arg.(*object.Hash).Pairs() {
+					merged.Set(pair.Key.(object.Hashable), pair.Value)
+				}
+			}
+
+			return merged
+		},
+	},
+
+	"int": &object.Builtin{
+		Fn: func(args []object.Object, named map[string]object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer, *object.BigInt:
+				return arg
+			case *object.Float:
+				if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+					return newError("float %s out of integer range", arg.Inspect())
+				}
+				value, _ := big.NewFloat(arg.Value).Int(nil)
+				return object.NewInteger(value)
+			case *object.Boolean:
+				if arg.Value {
+					return &object.Integer{Value: 1}
+				}
+				return &object.Integer{Value: 0}
+			case *object.String:
+				value, ok := new(big.Int).SetString(strings.TrimSpace(arg.Value), 0)
+				if !ok {
+					return newError("could not convert %q to integer", arg.Value)
+				}
+				return object.NewInteger(value)
+			default:
+				return newError("argument to `int` not supported, got %s", args[0].Type())
+			}
+		},
+	},
+
+	"float": &object.Builtin{
+		Fn: func(args []object.Object, named map[string]object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer, *object.BigInt:
+				return &object.Float{Value: toFloat(arg)}
+			case *object.Float:
+				return arg
+			case *object.String:
+				value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+				if err != nil {
+					return newError("could not convert %q to float", arg.Value)
+				}
+				return &object.Float{Value: value}
+			default:
+				return newError("argument to `float` not supported, got %s", args[0].Type())
+			}
+		},
+	},
+
+	"round": &object.Builtin{
+		Names: []string{"places"},
+		Fn: func(args []object.Object, named map[string]object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+
+			// The number of places can be given either way, but not both.
+			if len(args) == 2 {
+				if _, ok := named["places"]; ok {
+					return newError("multiple values for argument: places")
+				}
+				named = map[string]object.Object{"places": args[1]}
+			}
+
+			places := int64(0)
+			if arg, ok := named["places"]; ok {
+				p, ok := arg.(*object.Integer)
+				if !ok {
+					return newError("argument to `round` must be %s, got %s", object.INTEGER, arg.Type())
+				}
+				places = p.Value
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Integer, *object.BigInt:
+				return arg
+			case *object.Float:
+				scale := math.Pow(10, float64(places))
+				return &object.Float{Value: math.Round(arg.Value*scale) / scale}
+			default:
+				return newError("argument to `round` must be a number, got %s", args[0].Type())
+			}
+		},
+	},
+
+	"floor": &object.Builtin{
+		Fn: func(args []object.Object, named map[string]object.Object) object.Object {
+			return roundWith("floor", math.Floor, args)
+		},
+	},
+
+	"ceil": &object.Builtin{
+		Fn: func(args []object.Object, named map[string]object.Object) object.Object {
+			return roundWith("ceil", math.Ceil, args)
+		},
+	},
+}
+
+func roundWith(name string, fn func(float64) float64, args []object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *object.Integer, *object.BigInt:
+		return arg
+	case *object.Float:
+		return &object.Float{Value: fn(arg.Value)}
+	default:
+		return newError("argument to `%s` must be a number, got %s", name, args[0].Type())
+	}
 }
@@ -2,6 +2,10 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
 
 	"github.com/nomad-software/script/ast"
 	"github.com/nomad-software/script/object"
@@ -9,13 +13,40 @@ import (
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL     = &object.Null{}
+	TRUE     = &object.Boolean{Value: true}
+	FALSE    = &object.Boolean{Value: false}
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
-// Eval evaluates the AST.
-func Eval(node ast.Node, env *object.Env) object.Object {
+// Eval evaluates the AST, using the options of the environment. Scripts can
+// never crash the host program, any panic raised during evaluation is
+// recovered and returned as an error.
+func Eval(node ast.Node, env *object.Env) (obj object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			obj = newError("internal error: %v", r)
+		}
+	}()
+
+	return eval(node, env)
+}
+
+func eval(node ast.Node, env *object.Env) object.Object {
+	obj := evalNode(node, env)
+
+	// Errors are created without a location, the innermost node being
+	// evaluated at the time is the one which caused it.
+	if err, ok := obj.(*object.Error); ok && !err.Span.Start.IsValid() {
+		err.Span = token.Span{Start: node.Pos(), End: node.End()}
+		err.Stack = env.Frame()
+	}
+
+	return obj
+}
+
+func evalNode(node ast.Node, env *object.Env) object.Object {
 	switch node := node.(type) {
 
 	// Statements
@@ -26,26 +57,73 @@ func Eval(node ast.Node, env *object.Env) object.Object {
 		return evalBlockStatement(node, env)
 
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return eval(node.Expression, env)
 
 	case *ast.ReturnStatement:
-		val := Eval(node.Value, env)
-		if isError(val) {
+		if call, ok := node.Value.(*ast.CallExpression); ok && node.Tail {
+			return evalTailCall(call, env)
+		}
+		val := eval(node.Value, env)
+		if isSignal(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 
+	case *ast.ThrowStatement:
+		val := eval(node.Value, env)
+		if isSignal(val) {
+			return val
+		}
+		return newThrownError(val)
+
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
-		if isError(val) {
+		if node.Pattern != nil {
+			return evalDestructuringLet(node, env)
+		}
+		if env.IsLocalConst(node.Name.Value) {
+			return newError("cannot redeclare constant: %s", node.Name.Value)
+		}
+		val := eval(node.Value, env)
+		if isSignal(val) {
 			return val
 		}
 		env.Set(node.Name.Value, val)
 
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+
+	case *ast.ForInStatement:
+		return evalForInStatement(node, env)
+
+	case *ast.BreakStatement:
+		return BREAK
+
+	case *ast.ContinueStatement:
+		return CONTINUE
+
+	case *ast.ConstStatement:
+		if env.IsLocalConst(node.Name.Value) {
+			return newError("cannot redeclare constant: %s", node.Name.Value)
+		}
+		val := eval(node.Value, env)
+		if isSignal(val) {
+			return val
+		}
+		env.SetConst(node.Name.Value, val)
+
 	// Expressions
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return &object.BigInt{Value: node.Big}
+		}
 		return &object.Integer{Value: node.Value}
 
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 
@@ -53,67 +131,79 @@ func Eval(node ast.Node, env *object.Env) object.Object {
 		return nativeBoolToBooleanObject(node.Value)
 
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
-		if isError(right) {
+		right := eval(node.Right, env)
+		if isSignal(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return evalPrefixExpression(node.Operator, right, env)
 
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
+		left := eval(node.Left, env)
+		if isSignal(left) {
 			return left
 		}
 
-		right := Eval(node.Right, env)
-		if isError(right) {
+		if node.Operator == token.AND || node.Operator == token.OR {
+			return evalLogicalExpression(node, left, env)
+		}
+
+		right := eval(node.Right, env)
+		if isSignal(right) {
 			return right
 		}
 
-		return evalInfixExpression(node.Operator, left, right)
+		return evalInfixExpression(node.Operator, left, right, env)
+
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
 
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
+
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{Name: node.Name, Parameters: params, Env: env, Body: body}
 
 	case *ast.CallExpression:
-		function := Eval(node.Function, env)
-		if isError(function) {
-			return function
-		}
-
-		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
+		function, args, named, err := evalCall(node, env)
+		if err != nil {
+			return err
 		}
-
-		return applyFunction(function, args)
+		return applyFunction(function, args, named, env, node.Pos())
 
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
-		if len(elements) == 1 && isError(elements[0]) {
+		if len(elements) == 1 && isSignal(elements[0]) {
 			return elements[0]
 		}
 		return &object.Array{Elements: elements}
 
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
+		left := eval(node.Left, env)
+		if isSignal(left) {
 			return left
 		}
-		index := Eval(node.Index, env)
-		if isError(index) {
+		index := eval(node.Index, env)
+		if isSignal(index) {
 			return index
 		}
 		return evalIndexExpression(left, index)
 
+	case *ast.HashLiteral:
+		return evalHashLiteral(node, env)
+
+	case *ast.BadStatement, *ast.BadExpression:
+		return newError("invalid syntax")
 	}
 
 	return nil
@@ -123,7 +213,7 @@ func evalProgram(program *ast.Program, env *object.Env) object.Object {
 	var result object.Object
 
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = eval(statement, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
@@ -131,6 +221,9 @@ func evalProgram(program *ast.Program, env *object.Env) object.Object {
 
 		case *object.Error:
 			return result
+
+		case *object.Break, *object.Continue:
+			return newError("%s outside loop", result.Inspect())
 		}
 	}
 
@@ -144,12 +237,14 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	return FALSE
 }
 
-func evalPrefixExpression(operator string, right object.Object) object.Object {
+func evalPrefixExpression(operator string, right object.Object, env *object.Env) object.Object {
 	switch operator {
 	case "!":
 		return evalBangOperatorExpression(right)
 	case "-":
-		return evalMinusPrefixOperatorExpression(right)
+		return evalMinusPrefixOperatorExpression(right, env)
+	case "~":
+		return evalTildePrefixOperatorExpression(right)
 	default:
 		return NULL
 		// return newError("unknown operator: %s%s", operator, right.Type())
@@ -171,54 +266,221 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 		if node.Value == 0 {
 			return TRUE
 		}
+
+	case *object.Float:
+		if node.Value == 0 {
+			return TRUE
+		}
 	}
 	return FALSE
 }
 
-func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if !right.IsType(object.INTEGER) {
+func evalMinusPrefixOperatorExpression(right object.Object, env *object.Env) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		if right.Value == math.MinInt64 {
+			if env.Options().CheckedArithmetic {
+				return newError("integer overflow: -%d", right.Value)
+			}
+			return object.NewInteger(new(big.Int).Neg(toBigInt(right)))
+		}
+		return &object.Integer{Value: -right.Value}
+	case *object.BigInt:
+		return object.NewInteger(new(big.Int).Neg(right.Value))
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("invalid operation: -%s", right.Type())
 	}
+}
 
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+func evalTildePrefixOperatorExpression(right object.Object) object.Object {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: ^right.Value}
+	case *object.BigInt:
+		return object.NewInteger(new(big.Int).Not(right.Value))
+	default:
+		return newError("invalid operation: ~%s", right.Type())
+	}
 }
 
-func evalInfixExpression(operator string, left, right object.Object) object.Object {
+func evalInfixExpression(operator string, left, right object.Object, env *object.Env) object.Object {
 
 	if left.IsType(object.INTEGER) && right.IsType(object.INTEGER) {
-		return evalIntegerInfixExpression(operator, left, right)
+		return evalIntegerInfixExpression(operator, left, right, env)
+
+	} else if isNumber(left) && isNumber(right) {
+		return evalFloatInfixExpression(operator, left, right)
 
 	} else if left.IsType(object.STRING) && right.IsType(object.STRING) {
 		return evalStringInfixExpression(operator, left, right)
 
 	} else if operator == token.EQUAL {
-		return nativeBoolToBooleanObject(evalTruth(left) == evalTruth(right))
+		return nativeBoolToBooleanObject(left.Equal(right))
 
 	} else if operator == token.NOT_EQUAL {
-		return nativeBoolToBooleanObject(evalTruth(left) != evalTruth(right))
+		return nativeBoolToBooleanObject(!left.Equal(right))
 	}
 
 	return newError("invalid operation: %s %s %s", left.Type(), operator, right.Type())
 }
 
-func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
+// Integer arithmetic is done natively until a result overflows, at which point
+// it's redone using big integers.
+func evalIntegerInfixExpression(operator string, left, right object.Object, env *object.Env) object.Object {
+	l, lok := left.(*object.Integer)
+	r, rok := right.(*object.Integer)
+	if !lok || !rok {
+		return evalBigIntegerInfixExpression(operator, left, right)
+	}
+
+	leftVal := l.Value
+	rightVal := r.Value
 
 	switch operator {
 	case token.PLUS:
-		return &object.Integer{Value: leftVal + rightVal}
+		result := leftVal + rightVal
+		if (leftVal^result)&(rightVal^result) < 0 {
+			return evalIntegerOverflow(operator, left, right, env)
+		}
+		return &object.Integer{Value: result}
 	case token.MINUS:
-		return &object.Integer{Value: leftVal - rightVal}
+		result := leftVal - rightVal
+		if (leftVal^rightVal)&(leftVal^result) < 0 {
+			return evalIntegerOverflow(operator, left, right, env)
+		}
+		return &object.Integer{Value: result}
 	case token.ASTERISK:
+		if mulOverflows(leftVal, rightVal) {
+			return evalIntegerOverflow(operator, left, right, env)
+		}
 		return &object.Integer{Value: leftVal * rightVal}
 	case token.SLASH:
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		if leftVal == math.MinInt64 && rightVal == -1 {
+			return evalIntegerOverflow(operator, left, right, env)
+		}
 		return &object.Integer{Value: leftVal / rightVal}
+	case token.PERCENT:
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
+		return &object.Integer{Value: leftVal % rightVal}
+	case token.POWER:
+		if rightVal < 0 {
+			return &object.Float{Value: math.Pow(float64(leftVal), float64(rightVal))}
+		}
+		result, ok := intPow(leftVal, rightVal)
+		if !ok {
+			return evalIntegerOverflow(operator, left, right, env)
+		}
+		return &object.Integer{Value: result}
+	case token.AMPERSAND:
+		return &object.Integer{Value: leftVal & rightVal}
+	case token.PIPE:
+		return &object.Integer{Value: leftVal | rightVal}
+	case token.CARET:
+		return &object.Integer{Value: leftVal ^ rightVal}
+	case token.AND_NOT:
+		return &object.Integer{Value: leftVal &^ rightVal}
+	case token.SHIFT_LEFT:
+		if rightVal < 0 {
+			return newError("negative shift count: %d", rightVal)
+		}
+		if leftVal != 0 && (rightVal >= 64 || (leftVal<<rightVal)>>rightVal != leftVal) {
+			return evalIntegerOverflow(operator, left, right, env)
+		}
+		return &object.Integer{Value: leftVal << uint64(rightVal)}
+	case token.SHIFT_RIGHT:
+		if rightVal < 0 {
+			return newError("negative shift count: %d", rightVal)
+		}
+		return &object.Integer{Value: leftVal >> uint64(rightVal)}
+	case token.LT:
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case token.LT_EQUAL:
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case token.GT:
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case token.GT_EQUAL:
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case token.EQUAL:
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case token.NOT_EQUAL:
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("invalid operation: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// With checked arithmetic enabled, overflow is an error instead of promoting
+// the result to a big integer.
+func evalIntegerOverflow(operator string, left, right object.Object, env *object.Env) object.Object {
+	if env.Options().CheckedArithmetic {
+		return newError("integer overflow: %s %s %s", left.Inspect(), operator, right.Inspect())
+	}
+	return evalBigIntegerInfixExpression(operator, left, right)
+}
+
+func mulOverflows(a, b int64) bool {
+	if a == 0 {
+		return false
+	}
+	c := a * b
+	return c/a != b || (a == -1 && b == math.MinInt64)
+}
+
+// intPow raises base to a non-negative exponent by repeated squaring,
+// reporting false if the result overflows.
+func intPow(base, exp int64) (int64, bool) {
+	result := int64(1)
+	for exp > 0 {
+		if exp&1 == 1 {
+			if mulOverflows(result, base) {
+				return 0, false
+			}
+			result *= base
+		}
+		exp >>= 1
+		if exp > 0 {
+			if mulOverflows(base, base) {
+				return 0, false
+			}
+			base *= base
+		}
+	}
+	return result, true
+}
+
+// Integers are promoted to floats when mixed with them.
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch operator {
+	case token.PLUS:
+		return &object.Float{Value: leftVal + rightVal}
+	case token.MINUS:
+		return &object.Float{Value: leftVal - rightVal}
+	case token.ASTERISK:
+		return &object.Float{Value: leftVal * rightVal}
+	case token.SLASH:
+		return &object.Float{Value: leftVal / rightVal}
+	case token.PERCENT:
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case token.POWER:
+		return &object.Float{Value: math.Pow(leftVal, rightVal)}
 	case token.LT:
 		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case token.LT_EQUAL:
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
 	case token.GT:
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case token.GT_EQUAL:
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case token.EQUAL:
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case token.NOT_EQUAL:
@@ -228,6 +490,24 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	}
 }
 
+func isNumber(obj object.Object) bool {
+	return obj.IsType(object.INTEGER) || obj.IsType(object.FLOAT)
+}
+
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInt:
+		f, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return f
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
+
 func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
@@ -235,11 +515,43 @@ func evalStringInfixExpression(operator string, left, right object.Object) objec
 	switch operator {
 	case token.PLUS:
 		return &object.String{Value: leftVal + rightVal}
+	case token.LT:
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case token.LT_EQUAL:
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case token.GT:
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case token.GT_EQUAL:
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case token.EQUAL:
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case token.NOT_EQUAL:
+		return nativeBoolToBooleanObject(leftVal != rightVal)
 	default:
 		return newError("invalid operation: %s %s %s", left.Type(), operator, right.Type())
 	}
 }
 
+// The right operand of a logical expression is only evaluated when the left
+// one doesn't already decide the result.
+func evalLogicalExpression(node *ast.InfixExpression, left object.Object, env *object.Env) object.Object {
+	leftVal := evalTruth(left).Value
+
+	if node.Operator == token.AND && !leftVal {
+		return FALSE
+	}
+	if node.Operator == token.OR && leftVal {
+		return TRUE
+	}
+
+	right := eval(node.Right, env)
+	if isSignal(right) {
+		return right
+	}
+
+	return evalTruth(right)
+}
+
 func evalTruth(obj object.Object) *object.Boolean {
 	switch obj := obj.(type) {
 	case *object.Null:
@@ -254,6 +566,12 @@ func evalTruth(obj object.Object) *object.Boolean {
 		}
 		return FALSE
 
+	case *object.Float:
+		if obj.Value != 0 {
+			return TRUE
+		}
+		return FALSE
+
 	default:
 		return TRUE
 	}
@@ -263,37 +581,252 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Env) object.Objec
 	var result object.Object
 
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = eval(statement, env)
 
-		if result != nil {
-			if result.IsType(object.RETURN_VALUE) || result.IsType(object.ERROR) {
-				return result
-			}
+		if isSignal(result) {
+			return result
 		}
 	}
 
 	return result
 }
 
+// evalLoopBody reports whether the loop should carry on after evaluating its
+// body, along with anything which needs passing back up to the caller.
+func evalLoopBody(body *ast.BlockStatement, env *object.Env) (object.Object, bool) {
+	result := eval(body, env)
+
+	switch result.(type) {
+	case *object.Break:
+		return nil, false
+	case *object.ReturnValue, *object.Error:
+		return result, false
+	default:
+		return nil, true
+	}
+}
+
+// Like every loop, each iteration of the body has its own scope.
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Env) object.Object {
+	for {
+		condition := eval(ws.Condition, env)
+		if isSignal(condition) {
+			return condition
+		}
+
+		if !evalTruth(condition).Value {
+			return nil
+		}
+
+		if result, ok := evalLoopBody(ws.Body, object.NewChildEnv(env)); !ok {
+			return result
+		}
+	}
+}
+
+// Variables declared by the initialization clause are scoped to the loop. Each
+// iteration has its own copy of them, which the update clause of the next
+// iteration changes, so closures capture the values of that iteration.
+func evalForStatement(fs *ast.ForStatement, env *object.Env) object.Object {
+	env = object.NewChildEnv(env)
+
+	if fs.Init != nil {
+		if init := eval(fs.Init, env); isSignal(init) {
+			return init
+		}
+	}
+
+	for {
+		if fs.Condition != nil {
+			condition := eval(fs.Condition, env)
+			if isSignal(condition) {
+				return condition
+			}
+
+			if !evalTruth(condition).Value {
+				return nil
+			}
+		}
+
+		if result, ok := evalLoopBody(fs.Body, object.NewChildEnv(env)); !ok {
+			return result
+		}
+
+		env = env.Copy()
+
+		if fs.Update != nil {
+			if update := eval(fs.Update, env); isSignal(update) {
+				return update
+			}
+		}
+	}
+}
+
+// Each iteration of a for-in loop has its own scope, so closures capture the
+// value of that iteration.
+func evalForInStatement(fs *ast.ForInStatement, env *object.Env) object.Object {
+	iterable := eval(fs.Iterable, env)
+	if isSignal(iterable) {
+		return iterable
+	}
+
+	var elements []object.Object
+
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		elements = iterable.Elements
+	case *object.String:
+		for _, r := range iterable.Value {
+			elements = append(elements, &object.String{Value: string(r)})
+		}
+	case *object.Hash:
+		for _, pair := range iterable.Pairs() {
+			elements = append(elements, pair.Key)
+		}
+	default:
+		return newError("cannot iterate over %s", iterable.Type())
+	}
+
+	// Elements added to an array while looping over it are not visited.
+	for _, element := range elements {
+		loopEnv := object.NewChildEnv(env)
+		loopEnv.Set(fs.Name.Value, element)
+
+		if result, ok := evalLoopBody(fs.Body, loopEnv); !ok {
+			return result
+		}
+	}
+
+	return nil
+}
+
 func evalIfExpression(ie *ast.IfExpression, env *object.Env) object.Object {
-	condition := Eval(ie.Condition, env)
-	if isError(condition) {
+	condition := eval(ie.Condition, env)
+	if isSignal(condition) {
 		return condition
 	}
 
 	if evalTruth(condition).Value {
-		return Eval(ie.Consequence, env)
+		return eval(ie.Consequence, env)
 
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return eval(ie.Alternative, env)
 
 	} else {
 		return NULL
 	}
 }
 
+// The value of a match expression is null if none of its arms match. Each
+// attempt to match a pattern binds names into a new scope, which the guard
+// and body of the arm are evaluated in.
+func evalMatchExpression(me *ast.MatchExpression, env *object.Env) object.Object {
+	subject := eval(me.Subject, env)
+	if isSignal(subject) {
+		return subject
+	}
+
+	for _, arm := range me.Arms {
+		for _, pattern := range arm.Patterns {
+			scope := object.NewChildEnv(env)
+
+			matched, err := matchPattern(pattern, subject, scope)
+			if err != nil {
+				return err
+			}
+			if !matched {
+				continue
+			}
+
+			if arm.Guard != nil {
+				guard := eval(arm.Guard, scope)
+				if isSignal(guard) {
+					return guard
+				}
+				if evalTruth(guard) != TRUE {
+					continue
+				}
+			}
+
+			return eval(arm.Body, scope)
+		}
+	}
+
+	return NULL
+}
+
+// evalTryExpression evaluates the catch block in a new scope, with the caught
+// error bound as a hash. The finally block only changes the result when it
+// raises an error or leaves by a return, break or continue of its own.
+func evalTryExpression(te *ast.TryExpression, env *object.Env) object.Object {
+	result := eval(te.Block, env)
+
+	if err, ok := result.(*object.Error); ok && te.Catch != nil {
+		scope := object.NewChildEnv(env)
+		if te.Param != nil {
+			scope.Set(te.Param.Value, errorValue(err))
+		}
+		result = eval(te.Catch, scope)
+	}
+
+	if te.Finally != nil {
+		if final := eval(te.Finally, env); isSignal(final) {
+			return final
+		}
+	}
+
+	return result
+}
+
+// errorValue describes an error as a hash with "message", "kind" and
+// "payload" keys.
+func errorValue(err *object.Error) *object.Hash {
+	payload := err.Payload
+	if payload == nil {
+		payload = NULL
+	}
+
+	hash := object.NewHash()
+	hash.Set(&object.String{Value: "message"}, &object.String{Value: err.Message})
+	hash.Set(&object.String{Value: "kind"}, &object.String{Value: err.Kind})
+	hash.Set(&object.String{Value: "payload"}, payload)
+
+	return hash
+}
+
+// newThrownError creates the error raised by a throw statement. A string is
+// the message, and a hash with a "message" key is read in the same form that
+// caught errors are bound as, so they can be thrown again. Any other value is
+// thrown as the payload.
+func newThrownError(val object.Object) *object.Error {
+	err := &object.Error{Message: val.Inspect(), Kind: "error"}
+
+	switch val := val.(type) {
+	case *object.String:
+		err.Message = val.Value
+		return err
+
+	case *object.Hash:
+		message, ok := val.Get(&object.String{Value: "message"})
+		if !ok {
+			break
+		}
+		err.Message = message.Inspect()
+		if kind, ok := val.Get(&object.String{Value: "kind"}); ok {
+			err.Kind = kind.Inspect()
+		}
+		if payload, ok := val.Get(&object.String{Value: "payload"}); ok && !payload.IsType(object.NULL) {
+			err.Payload = payload
+		}
+		return err
+	}
+
+	err.Payload = val
+	return err
+}
+
 func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+	return &object.Error{Message: fmt.Sprintf(format, a...), Kind: "runtime"}
 }
 
 func isError(obj object.Object) bool {
@@ -303,6 +836,19 @@ func isError(obj object.Object) bool {
 	return false
 }
 
+// isSignal reports whether evaluation was cut short by an error, or by a
+// return, break or continue, which is passed up to the statement it belongs
+// to rather than being used as a value.
+func isSignal(obj object.Object) bool {
+	if obj != nil {
+		switch obj.Type() {
+		case object.RETURN_VALUE, object.ERROR, object.BREAK, object.CONTINUE:
+			return true
+		}
+	}
+	return false
+}
+
 func evalIdentifier(node *ast.Identifier, env *object.Env) object.Object {
 	if val, ok := env.Get(node.Value); ok {
 		return val
@@ -312,15 +858,15 @@ func evalIdentifier(node *ast.Identifier, env *object.Env) object.Object {
 		return builtin
 	}
 
-	return newError("identifier not found: " + node.Value)
+	return newError("identifier not found: %s", node.Value)
 }
 
 func evalExpressions(exps []ast.Expression, env *object.Env) []object.Object {
 	var result []object.Object
 
 	for _, e := range exps {
-		evaluated := Eval(e, env)
-		if isError(evaluated) {
+		evaluated := eval(e, env)
+		if isSignal(evaluated) {
 			return []object.Object{evaluated}
 		}
 		result = append(result, evaluated)
@@ -329,38 +875,343 @@ func evalExpressions(exps []ast.Expression, env *object.Env) []object.Object {
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// evalCall evaluates the function and arguments of a call.
+func evalCall(node *ast.CallExpression, env *object.Env) (object.Object, []object.Object, map[string]object.Object, object.Object) {
+	function := eval(node.Function, env)
+	if isSignal(function) {
+		return nil, nil, nil, function
+	}
+
+	args := evalArguments(node.Arguments, env)
+	if len(args) == 1 && isSignal(args[0]) {
+		return nil, nil, nil, args[0]
+	}
+
+	named, err := evalNamedArguments(node.Named, env)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return function, args, named, nil
+}
+
+// evalTailCall returns a call in tail position for applyFunction to make in
+// place of the current call, so recursion doesn't grow the stack. Builtins
+// are called straight away.
+func evalTailCall(node *ast.CallExpression, env *object.Env) object.Object {
+	function, args, named, err := evalCall(node, env)
+	if err != nil {
+		return err
+	}
+
+	fn, ok := function.(*object.Function)
+	current := env.Frame()
+	if !ok || current == nil {
+		val := applyFunction(function, args, named, env, node.Pos())
+		if isError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+	}
+
+	frame := &object.Frame{Function: fn.Name, Call: current.Call, Caller: current.Caller, Depth: current.Depth}
+
+	callEnv, err := bindArguments(fn, frame, args, named)
+	if err != nil {
+		return err
+	}
+
+	return &object.ReturnValue{Value: &object.TailCall{Function: fn, Env: callEnv}}
+}
+
+// evalArguments evaluates the arguments of a call, expanding any spread
+// arrays into separate arguments.
+func evalArguments(exps []ast.Expression, env *object.Env) []object.Object {
+	var result []object.Object
+
+	for _, e := range exps {
+		spread, ok := e.(*ast.SpreadExpression)
+		if !ok {
+			evaluated := eval(e, env)
+			if isSignal(evaluated) {
+				return []object.Object{evaluated}
+			}
+			result = append(result, evaluated)
+			continue
+		}
+
+		evaluated := eval(spread.Value, env)
+		if isSignal(evaluated) {
+			return []object.Object{evaluated}
+		}
+
+		array, ok := evaluated.(*object.Array)
+		if !ok {
+			return []object.Object{newError("cannot spread %s", evaluated.Type())}
+		}
+		result = append(result, array.Elements...)
+	}
+
+	return result
+}
+
+func evalNamedArguments(named []*ast.NamedArgument, env *object.Env) (map[string]object.Object, object.Object) {
+	result := map[string]object.Object{}
+
+	for _, arg := range named {
+		if _, ok := result[arg.Name.Value]; ok {
+			return nil, newError("duplicate named argument: %s", arg.Name.Value)
+		}
+
+		evaluated := eval(arg.Value, env)
+		if isSignal(evaluated) {
+			return nil, evaluated
+		}
+		result[arg.Name.Value] = evaluated
+	}
+
+	return result, nil
+}
+
+// sortedNames returns the names of the named arguments in a stable order, so
+// errors are reported consistently.
+func sortedNames(named map[string]object.Object) []string {
+	names := make([]string, 0, len(named))
+	for name := range named {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyFunction calls the function from the caller's scope, at the given
+// position.
+func applyFunction(fn object.Object, args []object.Object, named map[string]object.Object, caller *object.Env, call token.Position) object.Object {
 	switch fn := fn.(type) {
 
 	case *object.Function:
-		env := object.NewChildEnv(fn.Env)
+		frame := &object.Frame{Function: fn.Name, Call: call, Caller: caller.Frame(), Depth: 1}
+		if frame.Caller != nil {
+			frame.Depth = frame.Caller.Depth + 1
+		}
+		if limit := caller.Options().MaxCallDepth; limit > 0 && frame.Depth > limit {
+			return newError("stack overflow")
+		}
 
-		for i, param := range fn.Parameters {
-			env.Set(param.Value, args[i])
+		env, err := bindArguments(fn, frame, args, named)
+		if err != nil {
+			return err
 		}
 
-		obj := Eval(fn.Body, env)
+		// Tail calls are made here in a loop, rather than recursively.
+		for {
+			obj := eval(fn.Body, env)
+
+			switch obj := obj.(type) {
+			case *object.ReturnValue:
+				tail, ok := obj.Value.(*object.TailCall)
+				if !ok {
+					return obj.Value
+				}
+				fn, env = tail.Function, tail.Env
+				continue
+			case *object.Break, *object.Continue:
+				return newError("%s outside loop", obj.Inspect())
+			}
 
-		if r, ok := obj.(*object.ReturnValue); ok {
-			return r.Value
+			return obj
 		}
 
-		return obj
-
 	case *object.Builtin:
-		return fn.Fn(args...)
+		for _, name := range sortedNames(named) {
+			accepted := false
+			for _, n := range fn.Names {
+				accepted = accepted || n == name
+			}
+			if !accepted {
+				return newError("unknown named argument: %s", name)
+			}
+		}
+		return fn.Fn(args, named)
 
 	default:
 		return newError("not a function: %s", fn.Type())
 	}
 }
 
+// bindArguments creates the scope of a function call, binding the arguments
+// to the parameters, either by position or by name. Defaults are evaluated in
+// the new scope, so they can refer to the parameters before them.
+func bindArguments(fn *object.Function, frame *object.Frame, args []object.Object, named map[string]object.Object) (*object.Env, object.Object) {
+	required, limit := 0, 0
+	for _, param := range fn.Parameters {
+		switch {
+		case param.Rest:
+			limit = -1
+		case param.Default == nil:
+			required++
+			limit++
+		default:
+			limit++
+		}
+	}
+
+	count := len(args) + len(named)
+	if count < required || (limit >= 0 && len(args) > limit) {
+		switch {
+		case limit < 0:
+			return nil, newError("wrong number of arguments. got=%d, want at least %d", count, required)
+		case required != limit:
+			return nil, newError("wrong number of arguments. got=%d, want=%d to %d", count, required, limit)
+		default:
+			return nil, newError("wrong number of arguments. got=%d, want=%d", count, required)
+		}
+	}
+
+	for _, name := range sortedNames(named) {
+		index := -1
+		for i, param := range fn.Parameters {
+			if !param.Rest && param.Name.Value == name {
+				index = i
+			}
+		}
+		if index < 0 {
+			return nil, newError("unknown named argument: %s", name)
+		}
+		if index < len(args) {
+			return nil, newError("multiple values for argument: %s", name)
+		}
+	}
+
+	env := object.NewCallEnv(fn.Env, frame)
+
+	for i, param := range fn.Parameters {
+		switch {
+		case param.Rest:
+			rest := []object.Object{}
+			if i < len(args) {
+				rest = append(rest, args[i:]...)
+			}
+			env.Set(param.Name.Value, &object.Array{Elements: rest})
+
+		case i < len(args):
+			env.Set(param.Name.Value, args[i])
+
+		case named[param.Name.Value] != nil:
+			env.Set(param.Name.Value, named[param.Name.Value])
+
+		case param.Default != nil:
+			value := eval(param.Default, env)
+			if isError(value) {
+				return nil, value
+			}
+			env.Set(param.Name.Value, value)
+
+		default:
+			return nil, newError("missing argument: %s", param.Name.Value)
+		}
+	}
+
+	return env, nil
+}
+
+func evalAssignExpression(node *ast.AssignExpression, env *object.Env) object.Object {
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		return evalIdentifierAssignment(node, target, env)
+	case *ast.IndexExpression:
+		return evalIndexAssignment(node, target, env)
+	default:
+		return newError("cannot assign to %s", node.Target.String())
+	}
+}
+
+func evalIdentifierAssignment(node *ast.AssignExpression, target *ast.Identifier, env *object.Env) object.Object {
+	current, ok := env.Get(target.Value)
+	if !ok {
+		return newError("assignment to undeclared identifier: %s", target.Value)
+	}
+	if env.IsConst(target.Value) {
+		return newError("cannot assign to constant: %s", target.Value)
+	}
+
+	val := evalAssignedValue(node, current, env)
+	if isSignal(val) {
+		return val
+	}
+
+	env.Assign(target.Value, val)
+	return val
+}
+
+// Like reads, the target is evaluated before the value being assigned to it.
+func evalIndexAssignment(node *ast.AssignExpression, target *ast.IndexExpression, env *object.Env) object.Object {
+	left := eval(target.Left, env)
+	if isSignal(left) {
+		return left
+	}
+
+	index := eval(target.Index, env)
+	if isSignal(index) {
+		return index
+	}
+
+	var current object.Object
+	if node.Operator != token.ASSIGN {
+		current = evalIndexExpression(left, index)
+		if isError(current) {
+			return current
+		}
+	}
+
+	val := evalAssignedValue(node, current, env)
+	if isSignal(val) {
+		return val
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		if !index.IsType(object.INTEGER) {
+			return newError("index operator not supported: %s", left.Type())
+		}
+		i, ok := index.(*object.Integer)
+		if !ok || i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return newError("array access out of bounds")
+		}
+		left.Elements[i.Value] = val
+
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		left.Set(key, val)
+
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+
+	return val
+}
+
+// Compound assignments combine the value with the current one using the
+// operator preceding the '='.
+func evalAssignedValue(node *ast.AssignExpression, current object.Object, env *object.Env) object.Object {
+	val := eval(node.Value, env)
+	if isSignal(val) || node.Operator == token.ASSIGN {
+		return val
+	}
+
+	operator := strings.TrimSuffix(node.Operator, token.ASSIGN)
+	return evalInfixExpression(operator, current, val, env)
+}
+
 func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.IsType(object.ARRAY) && index.IsType(object.INTEGER):
 		return evalArrayIndexExpression(left, index)
-	// case left.Type() == object.HASH_OBJ:
-	// 	return evalHashIndexExpression(left, index)
+	case left.IsType(object.HASH):
+		return evalHashIndexExpression(left, index)
 	default:
 		return newError("index operator not supported: %s", left.Type())
 	}
@@ -368,12 +1219,58 @@ func evalIndexExpression(left, index object.Object) object.Object {
 
 func evalArrayIndexExpression(array, index object.Object) object.Object {
 	obj := array.(*object.Array)
-	idx := index.(*object.Integer).Value
 	max := int64(len(obj.Elements) - 1)
 
+	i, ok := index.(*object.Integer)
+	if !ok {
+		return newError("array access out of bounds")
+	}
+	idx := i.Value
+
 	if idx < 0 || idx > max {
 		return newError("array access out of bounds")
 	}
 
 	return obj.Elements[idx]
 }
+
+func evalHashIndexExpression(hash, index object.Object) object.Object {
+	obj := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+
+	value, ok := obj.Get(key)
+	if !ok {
+		return NULL
+	}
+
+	return value
+}
+
+func evalHashLiteral(node *ast.HashLiteral, env *object.Env) object.Object {
+	hash := object.NewHash()
+
+	for _, pair := range node.Pairs {
+		key := eval(pair.Key, env)
+		if isSignal(key) {
+			return key
+		}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+
+		value := eval(pair.Value, env)
+		if isSignal(value) {
+			return value
+		}
+
+		hash.Set(hashKey, value)
+	}
+
+	return hash
+}
@@ -1,6 +1,8 @@
 package evaluator
 
 import (
+	"math/big"
+	"strings"
 	"testing"
 
 	"github.com/nomad-software/script/object"
@@ -26,6 +28,24 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"10 % 3", 1},
+		{"-10 % 3", -1},
+		{"2 + 10 % 4 * 3", 8},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"(-2) ** 3", -8},
+		{"7 ** 0", 1},
+		{"12 & 10", 8},
+		{"12 | 10", 14},
+		{"12 ^ 10", 6},
+		{"12 &^ 10", 4},
+		{"1 << 10", 1024},
+		{"1024 >> 3", 128},
+		{"-16 >> 2", -4},
+		{"~0", -1},
+		{"~5", -6},
+		{"1 + 2 << 3", 17},
 	}
 
 	for _, tt := range tests {
@@ -58,11 +78,31 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
-		{"-1 == true", true},
+		{"-1 == true", false},
 		{"-1 != false", true},
-		{"0 == false", true},
-		{"1 == true", true},
+		{"0 == false", false},
+		{"1 == true", false},
 		{"1 != false", true},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"3 >= 2", true},
+		{"1.5 <= 1.5", true},
+		{"1 >= 1.5", false},
+		{"true && true", true},
+		{"true && false", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+		{"0 || 5", true},
+		{"false && undefined", false},
+		{"true || undefined", true},
+		{"let x = 5; x > 0 && x < 10", true},
+		{"6 & 3 == 2", true},
+		{"4 | 1 > 4", true},
 	}
 
 	for _, tt := range tests {
@@ -227,14 +267,46 @@ if (10 > 1) {
 			"[1, 2, 3][-1]",
 			"array access out of bounds",
 		},
-		// {
-		// 	`{"name": "Monkey"}[fn(x) { x }];`,
-		// 	"unusable as hash key: FUNCTION",
-		// },
-		// {
-		// 	`999[1]`,
-		// 	"index operator not supported: INTEGER",
-		// },
+		{
+			`{"name": "Monkey"}[fn(x) { x }];`,
+			"unusable as hash key: FUNCTION",
+		},
+		{
+			`999[1]`,
+			"index operator not supported: INTEGER",
+		},
+		{
+			`{[1]: 2}`,
+			"unusable as hash key: ARRAY",
+		},
+		{
+			"1 << -1",
+			"negative shift count: -1",
+		},
+		{
+			"8 >> -2",
+			"negative shift count: -2",
+		},
+		{
+			"1.5 & 1",
+			"invalid operation: FLOAT & INTEGER",
+		},
+		{
+			"~1.5",
+			"invalid operation: ~FLOAT",
+		},
+		{
+			"~true",
+			"invalid operation: ~BOOLEAN",
+		},
+		{
+			"1 / 0",
+			"division by zero",
+		},
+		{
+			"let x = 0; 10 % x",
+			"division by zero",
+		},
 	}
 
 	for _, tt := range tests {
@@ -310,6 +382,314 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestFunctionArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let add = fn(a, b = 10) { a + b }; add(1)", 11},
+		{"let add = fn(a, b = 10) { a + b }; add(1, 2)", 3},
+		{"let f = fn(a = 1, b = a * 2) { [a, b] }; f()", "[1, 2]"},
+		{"let f = fn(a = 1, b = a * 2) { [a, b] }; f(5)", "[5, 10]"},
+		{"let n = 0; let f = fn(a = n += 1) { a }; f(); f(); f(7); n", 2},
+		{"let f = fn(head, ...tail) { tail }; f(1, 2, 3)", "[2, 3]"},
+		{"let f = fn(head, ...tail) { tail }; f(1)", "[]"},
+		{"let f = fn(a, b = 2, ...rest) { [a, b, rest] }; f(1)", "[1, 2, []]"},
+		{"let f = fn(a, b = 2, ...rest) { [a, b, rest] }; f(1, 3, 5, 7)", "[1, 3, [5, 7]]"},
+		{"let add = fn(a, b, c) { a + b + c }; add(...[1, 2, 3])", 6},
+		{"let add = fn(a, b, c) { a + b + c }; let xs = [2, 3]; add(1, ...xs)", 6},
+		{"let f = fn(...xs) { xs }; f(...[1], 2, ...[], ...[3, 4])", "[1, 2, 3, 4]"},
+		{"len(...[[1, 2]])", 2},
+		{"let f = fn(...xs) { xs[0] = 9; xs }; let a = [1]; f(...a); a", "[1]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("%q wrong inspect. want=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestArgumentErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"fn(a, b) { a }(1)", "wrong number of arguments. got=1, want=2"},
+		{"fn() { 1 }(1)", "wrong number of arguments. got=1, want=0"},
+		{"fn(a, b = 1) { a }()", "wrong number of arguments. got=0, want=1 to 2"},
+		{"fn(a, b = 1) { a }(1, 2, 3)", "wrong number of arguments. got=3, want=1 to 2"},
+		{"fn(a, b, ...c) { a }(1)", "wrong number of arguments. got=1, want at least 2"},
+		{"fn(a, b = c) { a }(1)", "identifier not found: c"},
+		{"fn(a) { a }(...1)", "cannot spread INTEGER"},
+		{"fn(a) { a }(...b)", "identifier not found: b"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestNamedArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let f = fn(a, b) { a - b }; f(b: 1, a: 3)", 2},
+		{"let f = fn(a, b) { a - b }; f(3, b: 1)", 2},
+		{"let f = fn(x, retries = 1, verbose = false) { [x, retries, verbose] }; f(0, verbose: true)", "[0, 1, true]"},
+		{"let f = fn(x, retries = 1, verbose = false) { [x, retries, verbose] }; f(0, retries: 3, verbose: true)", "[0, 3, true]"},
+		{"let f = fn(a = 1, b = a + 1) { [a, b] }; f(a: 5)", "[5, 6]"},
+		{"let f = fn(a, ...rest) { [a, rest] }; f(a: 1)", "[1, []]"},
+		{"let f = fn(a, b) { [a, b] }; f(...[1], b: 2)", "[1, 2]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("%q wrong inspect. want=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestNamedArgumentErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"fn(a) { a }(b: 1)", "unknown named argument: b"},
+		{"fn(a, ...rest) { a }(1, rest: 2)", "unknown named argument: rest"},
+		{"fn(a) { a }(a: 1, a: 2)", "duplicate named argument: a"},
+		{"fn(a) { a }(1, a: 2)", "multiple values for argument: a"},
+		{"fn(a, b = 1, c) { a }", "invalid syntax"},
+		{"fn(a, b, c = 1) { a }(c: 1, b: 2)", "missing argument: a"},
+		{"fn(a, b) { a }(b: 1)", "wrong number of arguments. got=1, want=2"},
+		{"fn(a) { a }(a: b)", "identifier not found: b"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestTryExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { 1 / 0 } catch (e) { 2 }`, 2},
+		{`try { 1 / 0 } catch (e) { e["message"] }`, "division by zero"},
+		{`try { 1 / 0 } catch (e) { e["kind"] }`, "runtime"},
+		{`try { throw "boom" } catch (e) { [e["message"], e["kind"], e["payload"]] }`, "[boom, error, null]"},
+		{`try { throw 42 } catch (e) { [e["message"], e["payload"]] }`, "[42, 42]"},
+		{`try { throw {"message": "late", "kind": "timeout", "payload": [1]} } catch (e) { [e["message"], e["kind"], e["payload"]] }`, "[late, timeout, [1]]"},
+		{`try { throw {"code": 1} } catch (e) { e["payload"]["code"] }`, 1},
+		{`try { try { throw {"message": "m", "kind": "k"} } catch (e) { throw e } } catch (e) { e["kind"] }`, "k"},
+		{`try { throw "a" } catch { "caught" }`, "caught"},
+		{`let x = try { undefined } catch (e) { 5 }; x`, 5},
+		{`let f = fn() { throw "inner" }; try { f() } catch (e) { e["message"] }`, "inner"},
+		{`match (try { throw {"message": "m", "kind": "timeout"} } catch (e) { e }) { {"kind": "timeout"} => "retry", _ => "fail" }`, "retry"},
+		{`try { 1 } finally { 2 }`, 1},
+		{`let n = 0; try { n += 1 } finally { n += 10 }; n`, 11},
+		{`let n = 0; try { try { throw "x" } finally { n += 1 } } catch (e) { n }`, 1},
+		{`let n = 0; let f = fn() { try { return 1 } finally { n += 1 } }; f() + n`, 2},
+		{`let f = fn() { try { return 1 } finally { return 2 } }; f()`, 2},
+		{`let f = fn() { try { throw "x" } catch (e) { return 1 } finally { 3 } }; f()`, 1},
+		{`let n = 0; while (true) { try { break } finally { n += 1 } }; n`, 1},
+		{`let n = 0; for (let i = 0; i < 3; i += 1) { try { continue } finally { n += 1 } }; n`, 3},
+		{`let e = 1; try { throw "x" } catch (e) { e }; e`, 1},
+		{`let attempts = 0; let ok = false; while (!ok) { try { attempts += 1; if (attempts < 3) { throw "fail" }; ok = true } catch (e) {} }; attempts`, 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("%q wrong inspect. want=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestThrowErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+		expectedKind    string
+	}{
+		{`throw "boom"`, "boom", "error"},
+		{`throw {"message": "late", "kind": "timeout"}`, "late", "timeout"},
+		{`let f = fn() { throw "inner" }; f()`, "inner", "error"},
+		{`try { throw "a" } catch (e) { throw "b" }`, "b", "error"},
+		{`try { 1 } finally { throw "in finally" }`, "in finally", "error"},
+		{`try { throw "a" } finally { 1 }`, "a", "error"},
+		{`throw x`, "identifier not found: x", "runtime"},
+		{`try { 1 } catch (e) { 2 }; e`, "identifier not found: e", "runtime"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+
+		if errObj.Kind != tt.expectedKind {
+			t.Errorf("wrong error kind. expected=%q, got=%q", tt.expectedKind, errObj.Kind)
+		}
+	}
+}
+
+func TestStackTraces(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let divide = fn(a, b) { a / b };\nlet average = fn(xs) {\n  divide(xs[0] + xs[1], len(xs) - 2)\n};\naverage([1, 2]);",
+			"stack trace:\ndivide()\n\t1:25\naverage()\n\t3:3\n<script>\n\t5:1\n",
+		},
+		{
+			"const f = fn() { throw \"boom\" };\nfn() { f() }()",
+			"stack trace:\nf()\n\t1:18\n<anonymous>()\n\t2:8\n<script>\n\t2:1\n",
+		},
+		{
+			"let f = fn(a, b = c) { a };\nf(1)",
+			"stack trace:\nf()\n\t1:19\n<script>\n\t2:1\n",
+		},
+		{
+			"let f = fn(a) { a };\nf()",
+			"",
+		},
+		{
+			"1 / 0",
+			"",
+		},
+		{
+			"let f = fn() { try { 1 / 0 } catch (e) { 0 } };\nf();\nx",
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.StackTrace() != tt.expected {
+			t.Errorf("%q: wrong stack trace. expected=%q, got=%q", tt.input, tt.expected, errObj.StackTrace())
+		}
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let count = fn(n, acc) { if (n == 0) { return acc }; return count(n - 1, acc + 1) }; count(100000, 0)", 100000},
+		{`let even = fn(n) { if (n == 0) { return true }; return odd(n - 1) };
+		  let odd = fn(n) { if (n == 0) { return false }; return even(n - 1) };
+		  even(50001)`, "false"},
+		{"let f = fn(n) { while (true) { return g(n) } }; let g = fn(n) { n * 2 }; f(21)", 42},
+		{"let f = fn(xs) { return len(xs) }; f([1, 2, 3])", 3},
+		{"let f = fn(a, b = a + 1) { a + b }; let g = fn() { return f(1) }; g()", 3},
+		{"let f = fn() { return f }; f()()()", "fn() {\nreturn f\n}"},
+		{`let boom = fn() { throw "boom" }; let f = fn() { try { return boom() } catch (e) { return "caught" } }; f()`, "caught"},
+		{"let n = 0; let g = fn() { n += 1 }; let f = fn() { try { return g() } finally { n *= 10 } }; f(); n", 10},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("%q wrong inspect. want=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	recurse := "let f = fn(n) { if (n == 0) { return 0 }; 1 + f(n - 1) }; "
+
+	evaluated := testEval(recurse + "f(1000000)")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "stack overflow" {
+		t.Errorf("wrong error message. expected=%q, got=%q", "stack overflow", errObj.Message)
+	}
+
+	lines := strings.Split(errObj.StackTrace(), "\n")
+	if len(lines) != 203 || lines[201] != "...additional frames elided..." {
+		t.Errorf("stack trace not elided. got %d lines ending %q", len(lines), lines[len(lines)-2])
+	}
+
+	limited := object.Options{MaxCallDepth: 10}
+	testIntegerObject(t, testEvalWithOptions(recurse+"f(9)", limited), 9)
+
+	evaluated = testEvalWithOptions(recurse+"f(10)", limited)
+	if errObj, ok := evaluated.(*object.Error); !ok || errObj.Message != "stack overflow" {
+		t.Errorf("expected stack overflow error. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	unlimited := object.Options{MaxCallDepth: 0}
+	testIntegerObject(t, testEvalWithOptions(recurse+"f(20000)", unlimited), 20000)
+}
+
 func TestClosures(t *testing.T) {
 	input := `
 let newAdder = fn(x) {
@@ -362,6 +742,7 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
 		{`len([1, 2, 3])`, 3},
 		{`len([])`, 0},
+		{`len({"a": 1, "b": 2})`, 2},
 		{`print("hello", "world!")`, nil},
 		{`first([1, 2, 3])`, 1},
 		{`first([])`, []int{}},
@@ -381,6 +762,21 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`pop([1, 2, 3])`, []int{1, 2}},
 		{`pop([])`, []int{}},
 		{`pop(1)`, "argument to `pop` must be ARRAY, got INTEGER"},
+		{`keys({"a": 1, "b": 2})`, []string{"a", "b"}},
+		{`keys({})`, []string{}},
+		{`keys(1)`, "argument to `keys` must be HASH, got INTEGER"},
+		{`values({"a": 1, "b": 2})`, []int{1, 2}},
+		{`values(1)`, "argument to `values` must be HASH, got INTEGER"},
+		{`has({"a": 1}, "a")`, true},
+		{`has({"a": 1}, "b")`, false},
+		{`has({"a": 1}, [])`, "unusable as hash key: ARRAY"},
+		{`has(1, "a")`, "argument to `has` must be HASH, got INTEGER"},
+		{`keys(delete({"a": 1, "b": 2, "c": 3}, "b"))`, []string{"a", "c"}},
+		{`keys(delete({"a": 1}, "z"))`, []string{"a"}},
+		{`delete(1, "a")`, "argument to `delete` must be HASH, got INTEGER"},
+		{`values(merge({"a": 1, "b": 2}, {"b": 3, "c": 4}))`, []int{1, 3, 4}},
+		{`merge({"a": 1}, 2)`, "argument to `merge` must be HASH, got INTEGER"},
+		{`merge({"a": 1})`, "wrong number of arguments. got=1, want at least 2"},
 	}
 
 	for _, tt := range tests {
@@ -391,6 +787,8 @@ func TestBuiltinFunctions(t *testing.T) {
 			testIntegerObject(t, evaluated, int64(expected))
 		case nil:
 			testNullObject(t, evaluated)
+		case bool:
+			testBooleanObject(t, evaluated, expected)
 		case string:
 			errObj, ok := evaluated.(*object.Error)
 			if !ok {
@@ -416,6 +814,25 @@ func TestBuiltinFunctions(t *testing.T) {
 			for i, expectedElem := range expected {
 				testIntegerObject(t, array.Elements[i], int64(expectedElem))
 			}
+		case []string:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("obj not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+
+			if len(array.Elements) != len(expected) {
+				t.Errorf("wrong num of elements. want=%d, got=%d",
+					len(expected), len(array.Elements))
+				continue
+			}
+
+			for i, expectedElem := range expected {
+				str, ok := array.Elements[i].(*object.String)
+				if !ok || str.Value != expectedElem {
+					t.Errorf("wrong element %d. want=%q, got=%+v", i, expectedElem, array.Elements[i])
+				}
+			}
 		}
 	}
 }
@@ -487,3 +904,956 @@ func TestArrayIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedStart string
+		expectedEnd   string
+	}{
+		{"foobar", "1:1", "1:7"},
+		{"let a = 1;\nlet b = a + true;", "2:9", "2:17"},
+		{"let f = fn(x) {\n  x - \"s\"\n};\nf(1);", "2:3", "2:10"},
+		{"len(1, 2)", "1:1", "1:10"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Span.Start.String() != tt.expectedStart {
+			t.Errorf("%q error start wrong. want=%s, got=%s", tt.input, tt.expectedStart, errObj.Span.Start)
+		}
+
+		if errObj.Span.End.String() != tt.expectedEnd {
+			t.Errorf("%q error end wrong. want=%s, got=%s", tt.input, tt.expectedEnd, errObj.Span.End)
+		}
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := []struct {
+		key   object.Hashable
+		value int64
+	}{
+		{&object.String{Value: "one"}, 1},
+		{&object.String{Value: "two"}, 2},
+		{&object.String{Value: "three"}, 3},
+		{&object.Integer{Value: 4}, 4},
+		{TRUE, 5},
+		{FALSE, 6},
+	}
+
+	if result.Len() != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", result.Len())
+	}
+
+	for i, pair := range result.Pairs() {
+		if pair.Key.(object.Hashable).HashKey() != expected[i].key.HashKey() {
+			t.Errorf("pair %d has wrong key. want=%s, got=%s", i, expected[i].key.Inspect(), pair.Key.Inspect())
+		}
+		testIntegerObject(t, pair.Value, expected[i].value)
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestStringHashKey(t *testing.T) {
+	hello1 := &object.String{Value: "Hello World"}
+	hello2 := &object.String{Value: "Hello World"}
+	diff1 := &object.String{Value: "My name is johnny"}
+	diff2 := &object.String{Value: "My name is johnny"}
+
+	if hello1.HashKey() != hello2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if diff1.HashKey() != diff2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if hello1.HashKey() == diff1.HashKey() {
+		t.Errorf("strings with different content have same hash keys")
+	}
+
+	// Strings whose hashes collide are still told apart by their text.
+	if hello1.HashKey().Text != hello1.Value {
+		t.Errorf("string hash key doesn't hold its text. got=%q", hello1.HashKey().Text)
+	}
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{".5", 0.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3},
+		{"1 + 0.5", 1.5},
+		{"0.5 + 1", 1.5},
+		{"10 / 4.0", 2.5},
+		{"2 * 0.25", 0.5},
+		{"1e3 - 1", 999},
+		{"(1 + 2) * 1.5", 4.5},
+		{"75 / 300.0 * 100", 25},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testFloatObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestEvalFloatComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1.5 < 2", true},
+		{"2 > 1.5", true},
+		{"1.0 == 1", true},
+		{"1 != 1.0", false},
+		{"0.1 + 0.2 == 0.3", false},
+		{"!0.0", true},
+		{"!0.1", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"3.0", "3.0"},
+		{"3.25", "3.25"},
+		{"1e21", "1e+21"},
+		{"1 / 0.0", "+Inf"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q wrong inspect. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestNumericConversionBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`int(3.99)`, 3},
+		{`int(-3.99)`, -3},
+		{`int(7)`, 7},
+		{`int(true)`, 1},
+		{`int("42")`, 42},
+		{`int("0x1f")`, 31},
+		{`int("x")`, `could not convert "x" to integer`},
+		{`int(float("inf"))`, "float +Inf out of integer range"},
+		{`int([])`, "argument to `int` not supported, got ARRAY"},
+		{`float(2)`, 2.0},
+		{`float(" 2.5 ")`, 2.5},
+		{`float("nope")`, `could not convert "nope" to float`},
+		{`round(2.5)`, 3.0},
+		{`round(-2.5)`, -3.0},
+		{`round(3.14159, 2)`, 3.14},
+		{`round(3.14159, places: 3)`, 3.142},
+		{`round(3.14159, 2, places: 3)`, "multiple values for argument: places"},
+		{`round(3.14159, digits: 3)`, "unknown named argument: digits"},
+		{`len([], places: 3)`, "unknown named argument: places"},
+		{`round(4)`, 4},
+		{`round("a")`, "argument to `round` must be a number, got STRING"},
+		{`floor(2.7)`, 2.0},
+		{`floor(-2.1)`, -3.0},
+		{`ceil(2.1)`, 3.0},
+		{`ceil(5)`, 5},
+		{`ceil(true)`, "argument to `ceil` must be a number, got BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestEvalIntegerLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0x1F", 31},
+		{"0o755", 493},
+		{"0755", 493},
+		{"0b1010", 10},
+		{"1_000_000", 1000000},
+		{"0xFF_FF", 65535},
+		{"0x7FFFFFFFFFFFFFFF", 9223372036854775807},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestIdentifiersWithDigitsAndUnderscores(t *testing.T) {
+	input := `
+let user_id = 2;
+let item2 = 3;
+let _scale = 10;
+(user_id + item2) * _scale;`
+
+	testIntegerObject(t, testEval(input), 50)
+}
+
+func TestEvalFloatOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"5.5 % 2", 1.5},
+		{"-5.5 % 2", -1.5},
+		{"2.0 ** 3", 8},
+		{"4 ** 0.5", 2},
+		{"2 ** -1", 0.5},
+		{"10 ** -2", 0.01},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testFloatObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestShortCircuitErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"true && undefined", "identifier not found: undefined"},
+		{"false || undefined", "identifier not found: undefined"},
+		{"undefined && false", "identifier not found: undefined"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestCheckedArithmetic(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"9223372036854775807 + 1", "integer overflow: 9223372036854775807 + 1"},
+		{"-9223372036854775807 - 2", "integer overflow: -9223372036854775807 - 2"},
+		{"4611686018427387904 * 2", "integer overflow: 4611686018427387904 * 2"},
+		{"let min = -9223372036854775807 - 1; min / -1", "integer overflow: -9223372036854775808 / -1"},
+		{"let min = -9223372036854775807 - 1; -min", "integer overflow: --9223372036854775808"},
+	}
+
+	checked := object.Options{CheckedArithmetic: true}
+
+	for _, tt := range tests {
+		evaluated := testEvalWithOptions(tt.input, checked)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+
+	testIntegerObject(t, testEvalWithOptions("9223372036854775806 + 1", checked), 9223372036854775807)
+	testIntegerObject(t, testEvalWithOptions("-3037000499 * 3037000499", checked), -9223372030926249001)
+
+	if evaluated, ok := testEval("9223372036854775807 + 1").(*object.BigInt); !ok {
+		t.Errorf("overflow checked by default. got=%T(%+v)", evaluated, evaluated)
+	}
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"4611686018427387904 * 2", "9223372036854775808"},
+		{"let min = -9223372036854775807 - 1; min / -1", "9223372036854775808"},
+		{"let min = -9223372036854775807 - 1; -min", "9223372036854775808"},
+		{"2 ** 64", "18446744073709551616"},
+		{"1 << 64", "18446744073709551616"},
+		{"-1 << 63", "-9223372036854775808"},
+		{"99999999999999999999", "99999999999999999999"},
+		{"0xFFFF_FFFF_FFFF_FFFF_FF", "4722366482869645213695"},
+		{"-99999999999999999999 * 10", "-999999999999999999990"},
+		{"99999999999999999999 % 7", "1"},
+		{"99999999999999999999 / 0x10", "6249999999999999999"},
+		{"~99999999999999999999", "-100000000000000000000"},
+		{"(2 ** 100) >> 98", "4"},
+		{"(2 ** 64 + 1) & 3", "1"},
+		{"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(25)", "15511210043330985984000000"},
+		{"2 ** 64 > 9223372036854775807", "true"},
+		{"2 ** 64 == 18446744073709551616", "true"},
+		{"2 ** 64 == 2 ** 65", "false"},
+		{"2 ** 64 + 0.5", "1.8446744073709552e+19"},
+		{"2 ** -64 == 1 / float(2 ** 64)", "true"},
+		{"int(1e20)", "100000000000000000000"},
+		{`int("123456789012345678901234567890")`, "123456789012345678901234567890"},
+		{"[1, 2, 3][2 ** 64]", "ERROR: 1:1: array access out of bounds"},
+		{"99999999999999999999 / 0", "ERROR: 1:1: division by zero"},
+		{"1 << 2 ** 64", "ERROR: 1:1: shift count too large: 18446744073709551616"},
+		{"2 ** 10000000000", "ERROR: 1:1: integer result too large"},
+		{"1 << 4294967295", "ERROR: 1:1: integer result too large"},
+		{"let x = 2 ** 500000; x * x * x", "ERROR: 1:22: integer result too large"},
+		{"1 ** 10000000000", "1"},
+		{"-1 ** 10000000001", "-1"},
+		{"0 << 4294967295", "0"},
+		{"(2 ** 500000) >> 499998", "4"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q wrong inspect. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestBigIntegerDemotion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"9223372036854775807 + 1 - 1", 9223372036854775807},
+		{"-9223372036854775808", -9223372036854775808},
+		{"99999999999999999999 - 99999999999999999998", 1},
+		{"2 ** 64 / 2 ** 60", 16},
+		{"(2 ** 64) >> 64", 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testIntegerObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBigIntegerHashKeys(t *testing.T) {
+	evaluated := testEval(`let h = {2 ** 64: "big", 1: "small"}; [h[2 ** 64], h[18446744073709551616], h[1], h[2 ** 65]]`)
+
+	expected := `[big, big, small, null]`
+	if evaluated.Inspect() != expected {
+		t.Errorf("wrong inspect. want=%q, got=%q", expected, evaluated.Inspect())
+	}
+
+	big1 := &object.BigInt{Value: new(big.Int).Lsh(big.NewInt(1), 64)}
+	big2 := &object.BigInt{Value: new(big.Int).Lsh(big.NewInt(1), 65)}
+	small := &object.Integer{Value: int64(big1.HashKey().Value)}
+
+	if big1.HashKey() == big2.HashKey() {
+		t.Errorf("big integers with different values have same hash keys")
+	}
+
+	if big1.HashKey() == small.HashKey() {
+		t.Errorf("big integer has the same hash key as an integer")
+	}
+}
+
+func TestEvalRecoversFromPanics(t *testing.T) {
+	builtins["explode"] = &object.Builtin{
+		Fn: func(args []object.Object, named map[string]object.Object) object.Object {
+			panic("boom")
+		},
+	}
+	defer delete(builtins, "explode")
+
+	evaluated := testEval("explode()")
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	if errObj.Message != "internal error: boom" {
+		t.Errorf("wrong error message. expected=%q, got=%q", "internal error: boom", errObj.Message)
+	}
+}
+
+func TestEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"a" + "b" == "ab"`, true},
+		{`"1" == 1`, false},
+		{`"" == false`, false},
+		{"[1, 2, 3] == [1, 2, 3]", true},
+		{"[1, 2, 3] == [1, 2]", false},
+		{"[1] == [2]", false},
+		{"[1] != [2]", true},
+		{"[] == []", true},
+		{`[1, "a", [true]] == [1, "a", [true]]`, true},
+		{`[1, "a", [true]] == [1, "a", [false]]`, false},
+		{"[1] == [1.0]", true},
+		{"[2 ** 64] == [2 ** 64]", true},
+		{`{"a": 1, "b": 2} == {"b": 2, "a": 1}`, true},
+		{`{"a": 1} == {"a": 2}`, false},
+		{`{"a": 1} == {"a": 1, "b": 2}`, false},
+		{`{"a": [1, {"b": 2}]} == {"a": [1, {"b": 2}]}`, true},
+		{"{} == []", false},
+		{"let f = fn(x) { x }; f == f", true},
+		{"fn(x) { x } == fn(x) { x }", false},
+		{"len == len", true},
+		{"len == first", false},
+		{"if (false) { 1 } == if (false) { 2 }", true},
+		{"if (false) { 1 } == false", false},
+		{"if (false) { 1 } == 0", false},
+		{"if (false) { 1 } != []", true},
+		{"true == 1", false},
+		{"1 == 1.0", true},
+		{"2 ** 64 == 18446744073709551616.0", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if !testBooleanObject(t, evaluated, tt.expected) {
+			t.Errorf("input: %q", tt.input)
+		}
+	}
+}
+
+func TestCyclicEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"let a = [1]; a[0] = a; a == a", true},
+		{"let a = [1]; a[0] = a; a != a", false},
+		{"let a = [1]; a[0] = a; let b = [1]; b[0] = b; a == b", false},
+		{"let a = [1]; a[0] = a; a == [a]", true},
+		{"let a = [1]; a[0] = a; a == [1]", false},
+		{`let h = {}; h["self"] = h; h == h`, true},
+		{`let h = {}; h["self"] = h; let g = {}; g["self"] = g; h == g`, false},
+		{`let h = {}; h["self"] = h; h == {"self": h}`, true},
+		{`let h = {}; let a = [h]; h["a"] = a; [h] == a`, true},
+		{"let x = [1]; [x, x] == [[1], [1]]", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if !testBooleanObject(t, evaluated, tt.expected) {
+			t.Errorf("%q: wrong result", tt.input)
+		}
+	}
+}
+
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" < "b"`, true},
+		{`"b" < "a"`, false},
+		{`"a" > "b"`, false},
+		{`"abc" > "abb"`, true},
+		{`"ab" < "abc"`, true},
+		{`"" < "a"`, true},
+		{`"a" <= "a"`, true},
+		{`"b" >= "a"`, true},
+		{`"B" < "a"`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if !testBooleanObject(t, evaluated, tt.expected) {
+			t.Errorf("input: %q", tt.input)
+		}
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; x = x + 1", 2},
+		{"let x = 1; let y = 2; x = y = 3; x + y", 6},
+		{"let x = 10; x += 5; x", 15},
+		{"let x = 10; x -= 5; x", 5},
+		{"let x = 10; x *= 5; x", 50},
+		{"let x = 10; x /= 5; x", 2},
+		{"let x = 10; x %= 4; x", 2},
+		{"let x = 2; x **= 3; x", 8},
+		{"let x = 12; x &= 10; x", 8},
+		{"let x = 12; x |= 10; x", 14},
+		{"let x = 12; x ^= 10; x", 6},
+		{"let x = 12; x &^= 10; x", 4},
+		{"let x = 1; x <<= 4; x", 16},
+		{"let x = 16; x >>= 2; x", 4},
+		{`let s = "a"; s += "b"; s`, "ab"},
+		{"let x = 1.5; x *= 2; x", 3.0},
+		{"let counter = fn() { let n = 0; fn() { n += 1 } }; let next = counter(); next(); next(); next()", 3},
+		{"let x = 1; let f = fn() { x = 5 }; f(); x", 5},
+		{"let x = 1; let f = fn() { let x = 2; x = 5 }; f(); x", 1},
+		{"let a = [1, 2, 3]; a[1] = 5; a", "[1, 5, 3]"},
+		{"let a = [1, 2, 3]; a[2] += 10; a[2]", 13},
+		{"let a = [1, 2, 3]; let b = a; b[0] = 0; a", "[0, 2, 3]"},
+		{"let a = [[1], [2]]; a[1][0] = 3; a", "[[1], [3]]"},
+		{`let h = {"a": 1}; h["a"] = 2; h["b"] = 3; h`, "{a: 2, b: 3}"},
+		{`let h = {"n": 1}; h["n"] *= 7; h["n"]`, 7},
+		{"let a = [1]; a[0] = 2", 2},
+		{"let x = 0; if (true) { x = 1 }; x", 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("%q wrong inspect. want=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestSelfReferentialContainers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = [1, 2]; a[0] = a; a", "[[...], 2]"},
+		{`let h = {"n": 1}; h["self"] = h; h`, "{n: 1, self: {...}}"},
+		{`let h = {}; let a = [h]; h["a"] = a; a`, "[{a: [...]}]"},
+		{"let x = [1]; [x, x]", "[[1], [1]]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q wrong inspect. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"x = 5", "assignment to undeclared identifier: x"},
+		{"x += 5", "assignment to undeclared identifier: x"},
+		{"let f = fn() { y = 1 }; f()", "assignment to undeclared identifier: y"},
+		{"len = 5", "assignment to undeclared identifier: len"},
+		{`let x = 1; x += "a"`, "invalid operation: INTEGER + STRING"},
+		{"let a = [1]; a[1] = 2", "array access out of bounds"},
+		{"let a = [1]; a[-1] = 2", "array access out of bounds"},
+		{"let a = [1]; a[5] += 2", "array access out of bounds"},
+		{`let a = [1]; a["x"] = 2`, "index operator not supported: ARRAY"},
+		{"let h = {}; h[[1]] = 2", "unusable as hash key: ARRAY"},
+		{`let h = {}; h["x"] += 1`, "invalid operation: NULL + INTEGER"},
+		{`let s = "abc"; s[0] = "x"`, "index assignment not supported: STRING"},
+		{"let x = 1; x = y", "identifier not found: y"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"const a = 5; a;", 5},
+		{"const a = 5; let b = a * 2; b;", 10},
+		{"const a = 5; let f = fn() { let a = 1; a = 2; a }; f();", 2},
+		{"const a = 5; let f = fn(a) { a = a + 1; a }; f(1);", 2},
+		{"const a = 5; let f = fn() { const a = 7; a }; f() + a;", 12},
+		{"const a = [1]; a[0] = 2; a[0]", 2},
+		{"let a = 1; const a = 3; a", 3},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestConstErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"const a = 5; a = 6;", "cannot assign to constant: a"},
+		{"const a = 5; a += 1;", "cannot assign to constant: a"},
+		{"const a = 5; let f = fn() { a = 6 }; f();", "cannot assign to constant: a"},
+		{"const a = 5; let a = 6;", "cannot redeclare constant: a"},
+		{"const a = 5; const a = 6;", "cannot redeclare constant: a"},
+		{"const a = b;", "identifier not found: b"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (i < 10) { i += 1 }; i", 10},
+		{"let i = 0; while (false) { i += 1 }; i", 0},
+		{"let n = 0; for (let i = 0; i < 5; i += 1) { n += i }; n", 10},
+		{"let n = 0; let i = 0; for (; i < 5;) { i += 1; n += 2 }; n", 10},
+		{"let n = 0; for (;;) { n += 1; if (n == 3) { break } }; n", 3},
+		{"let n = 0; for (let i = 0; i < 10; i += 1) { if (i % 2 == 0) { continue } n += i }; n", 25},
+		{"let n = 0; let i = 0; while (true) { i += 1; if (i > 4) { break } if (i == 2) { continue } n += i }; n", 8},
+		{"let n = 0; for (x in [1, 2, 3]) { n += x }; n", 6},
+		{`let s = ""; for (c in "héllo") { s = c + s }; s`, "olléh"},
+		{`let n = 0; for (k in {"a": 1, "b": 2}) { n += len(k) }; n`, 2},
+		{`let h = {"a": 1, "b": 2}; let n = 0; for (k in h) { n += h[k] }; n`, 3},
+		{"let n = 0; for (i in [1, 2, 3]) { for (j in [1, 2, 3]) { if (j > i) { break } n += 1 } }; n", 6},
+		{"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10 } } 0 }; f()", 20},
+		{"let f = fn() { let i = 0; while (true) { i += 1; if (i == 7) { return i } } }; f()", 7},
+		{"let fs = []; for (x in [1, 2, 3]) { push(fs, fn() { x }) }; fs[0]() + fs[2]()", 4},
+		{"let fs = []; for (let i = 1; i < 4; i += 1) { push(fs, fn() { i }) }; fs[0]() + fs[2]()", 4},
+		{"let fs = []; let i = 1; while (i < 4) { let x = i; push(fs, fn() { x }); i += 1 }; fs[0]() + fs[2]()", 4},
+		{"let n = 0; for (let i = 0; i < 10; i += 1) { i += 1; n += 1 }; n", 5},
+		{"let fs = []; for (let i = 0; i < 2; i += 1) { push(fs, fn() { i += 10; i }) }; [fs[0](), fs[0](), fs[1]()]", "[10, 20, 11]"},
+		{"let a = [1, 2]; let n = 0; for (x in a) { push(a, x); n += 1 }; n", 2},
+		{"let i = 5; for (let i = 0; i < 3; i += 1) { }; i", 5},
+		{"let n = 0; for (x in []) { n += 1 }; n", 0},
+		{"let n = 0; for (let i = 0; i < 100000; i += 1) { n += 1 }; n", 100000},
+		{"let a = []; for (let i = 0; i < 3; i += 1) { push(a, i * i) }; a", "[0, 1, 4]"},
+		{"let a = []; for (x in [1, 2, 3]) { let y = if (x == 2) { break } else { x }; push(a, y) }; a", "[1]"},
+		{"let a = []; for (x in [1, 2, 3]) { let y = if (x == 2) { continue } else { x }; push(a, y) }; a", "[1, 3]"},
+		{"let a = []; for (x in [1, 2, 3]) { push(a, if (x == 2) { break } else { x }) }; a", "[1]"},
+		{"let a = []; for (x in [1, 2, 3]) { push(a, [x, if (x == 2) { continue } else { x }]) }; a", "[[1, 1], [3, 3]]"},
+		{"let n = 0; for (x in [1, 2, 3]) { n = if (x == 2) { break } else { x } }; n", 1},
+		{"let n = 0; for (x in [1, 2, 3]) { n += if (x == 2) { continue } else { x } }; n", 4},
+		{"let f = fn(x) { let y = if (x > 0) { return 1 } else { 0 }; y - 1 }; [f(1), f(0)]", "[1, -1]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("%q wrong inspect. want=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestLoopErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"for (x in 5) { }", "cannot iterate over INTEGER"},
+		{"for (x in y) { }", "identifier not found: y"},
+		{"while (x) { }", "identifier not found: x"},
+		{"let i = 0; while (true) { i += 1; if (i == 3) { i + true } }", "invalid operation: INTEGER + BOOLEAN"},
+		{"for (let i = 0; i < 3; i += true) { }", "invalid operation: INTEGER + BOOLEAN"},
+		{"let i = 0; while (i < 1) { let y = i; i += 1 }; y", "identifier not found: y"},
+		{"for (let i = 0; i < 1; i += 1) { let y = i }; y", "identifier not found: y"},
+		{"for (x in [1]) { let y = x }; y", "identifier not found: y"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestElseIfExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"if (false) { 1 } else if (true) { 2 } else { 3 }", 2},
+		{"if (false) { 1 } else if (false) { 2 } else { 3 }", 3},
+		{"if (true) { 1 } else if (true) { 2 } else { 3 }", 1},
+		{"if (false) { 1 } else if (false) { 2 }", nil},
+		{"let f = fn(n) { if (n < 0) { -1 } else if (n == 0) { 0 } else if (n < 10) { 1 } else { 2 } }; [f(-5), f(0), f(5), f(50)]", "[-1, 0, 1, 2]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("%q wrong inspect. want=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`match (1) { 1, 2 => "low", 3 => "high" }`, "low"},
+		{`match (2) { 1, 2 => "low", 3 => "high" }`, "low"},
+		{`match (3) { 1, 2 => "low", 3 => "high" }`, "high"},
+		{`match (4) { 1, 2 => "low", _ => "other" }`, "other"},
+		{`match ("x") { 1 => "one", "x" => "ex", _ => "other" }`, "ex"},
+		{`match ([1, 2]) { [1] => "one", [1, 2] => "two" }`, "two"},
+		{`let y = 5; match (5) { y => "y", _ => "other" }`, "y"},
+		{`match (1 + 1) { n if n == 1 + 1 => "two" }`, "two"},
+		{`match (true) { false => 0, true => { let a = 40; a + 2 } }`, 42},
+		{`match (7) { 1 => 1 }`, nil},
+		{`match (1) { _ => 1, 1 => 2 }`, 1},
+		{`match (2) { 1 => undefined, 2 => 2 }`, 2},
+		{`let f = fn(x) { match (x) { 0 => { return "zero" }, _ => "many" }; "after" }; f(0) + f(1)`, "zeroafter"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("%q wrong inspect. want=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestPatternMatching(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`match ([1, 2, 3]) { [first, ...rest] => rest }`, "[2, 3]"},
+		{`match ([1]) { [first, ...rest] => rest }`, "[]"},
+		{`match ([]) { [first, ...rest] => first, [] => "empty" }`, "empty"},
+		{`match ([1, 2]) { [a] => a, [a, b, c] => c, [a, b] => a + b }`, 3},
+		{`match ([1, [2, 3]]) { [a, [_, c]] => a + c }`, 4},
+		{`match ([1, 2, 3]) { [1, ..._] => "starts with one" }`, "starts with one"},
+		{`match ("abc") { [a, ...b] => a, _ => "not an array" }`, "not an array"},
+		{`match ({"name": "ann", "age": 30}) { {"name": n, "age": a} => a }`, 30},
+		{`match ({"name": "ann"}) { {"name": n, "age": a} => a, {"name": n} => n }`, "ann"},
+		{`match ({1: {true: 2}}) { {1: {true: x}} => x }`, 2},
+		{`match ({"kind": "circle", "r": 2}) { {"kind": "square", "side": s} => s, {"kind": "circle", "r": r} => r }`, 2},
+		{`match (1.5) { x: int => "int", x: float => "float" }`, "float"},
+		{`match ("s") { _: int => "int", _: string => "string" }`, "string"},
+		{`match (len) { f: fn => "fn" }`, "fn"},
+		{`match (fn() {}) { f: fn => "fn" }`, "fn"},
+		{`match ([1, "a"]) { [a: int, b: int] => "ints", [a: int, b: string] => b }`, "a"},
+		{`match (match (1) { 2 => 2 }) { _: null => "null" }`, "null"},
+		{`match (-1) { -1 => "minus one" }`, "minus one"},
+		{`match (5) { n if n < 0 => "negative", n if n > 0 => "positive", _ => "zero" }`, "positive"},
+		{`match (0) { n if n < 0 => "negative", n if n > 0 => "positive", _ => "zero" }`, "zero"},
+		{`match ([3, 4]) { [a, b], [a, b, _] if a < b => b }`, 4},
+		{`match ([4, 3]) { [a, b] if a < b => b }`, nil},
+		{`let x = 1; match (2) { x => x }; x`, 1},
+		{`let x = 1; match (2) { x => { x = 3 } }; x`, 1},
+		{`let y = 1; match (2) { x => { y = x } }; y`, 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("%q wrong inspect. want=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestDestructuringLet(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let [a, b] = [1, 2]; a + b", 3},
+		{"let [head, ...tail] = [1, 2, 3]; tail", "[2, 3]"},
+		{"let [_, second] = [1, 2]; second", 2},
+		{`let {"name": n, "tags": [first, ..._]} = {"name": "x", "tags": ["a", "b"]}; n + first`, "xa"},
+		{"let a = 1; let f = fn() { let [a] = [2]; a }; f() + a", 3},
+		{"let arr = [1, 2]; let [_, ...rest] = arr; rest[0] = 5; arr", "[1, 2]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if evaluated.Inspect() != expected {
+				t.Errorf("%q wrong inspect. want=%q, got=%q", tt.input, expected, evaluated.Inspect())
+			}
+		}
+	}
+}
+
+func TestPatternErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"let [a, b] = [1];", "pattern [a, b] does not match [1]"},
+		{`let {"a": x} = {"b": 1};`, `pattern {a: x} does not match {b: 1}`},
+		{"let [a] = 1;", "pattern [a] does not match 1"},
+		{"const a = 1; let [a, b] = [2, 3];", "cannot redeclare constant: a"},
+		{"let [a] = [b];", "identifier not found: b"},
+		{"match (1) { x: integer => x }", "unknown type in pattern: integer"},
+		{"match (1) { x if y => x }", "identifier not found: y"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package evaluator
 
 import (
+	"math"
 	"testing"
 
 	"github.com/nomad-software/script/lexer"
@@ -9,10 +10,14 @@ import (
 )
 
 func testEval(input string) object.Object {
+	return testEvalWithOptions(input, object.Options{MaxCallDepth: object.DefaultMaxCallDepth})
+}
+
+func testEvalWithOptions(input string, options object.Options) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.Parse()
-	env := object.NewEnv()
+	env := object.NewEnvWithOptions(options)
 
 	return Eval(program, env)
 }
@@ -52,3 +57,17 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 	}
 	return true
 }
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if math.Abs(result.Value-expected) > 1e-9 {
+		t.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+		return false
+	}
+
+	return true
+}
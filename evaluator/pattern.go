@@ -0,0 +1,155 @@
+package evaluator
+
+import (
+	"github.com/nomad-software/script/ast"
+	"github.com/nomad-software/script/object"
+)
+
+// The names which can be used in type patterns, such as 'x: int'.
+var patternTypes = map[string][]object.Type{
+	"array":  {object.ARRAY},
+	"bool":   {object.BOOLEAN},
+	"float":  {object.FLOAT},
+	"fn":     {object.FUNCTION, object.BUILTIN},
+	"hash":   {object.HASH},
+	"int":    {object.INTEGER},
+	"null":   {object.NULL},
+	"string": {object.STRING},
+}
+
+// matchPattern reports whether the value matches the pattern, binding any
+// names in the pattern into env as it goes. The bindings are incomplete when
+// the value doesn't match, so env should be a scope which is thrown away.
+func matchPattern(pattern ast.Pattern, value object.Object, env *object.Env) (bool, *object.Error) {
+	switch pattern := pattern.(type) {
+	case *ast.BindingPattern:
+		return matchBindingPattern(pattern, value, env)
+
+	case *ast.LiteralPattern:
+		literal := eval(pattern.Value, env)
+		if err, ok := literal.(*object.Error); ok {
+			return false, err
+		}
+		return value.Equal(literal), nil
+
+	case *ast.ArrayPattern:
+		return matchArrayPattern(pattern, value, env)
+
+	case *ast.HashPattern:
+		return matchHashPattern(pattern, value, env)
+	}
+
+	return false, newError("unknown pattern: %s", pattern)
+}
+
+func matchBindingPattern(pattern *ast.BindingPattern, value object.Object, env *object.Env) (bool, *object.Error) {
+	if pattern.Type != nil {
+		types, ok := patternTypes[pattern.Type.Value]
+		if !ok {
+			return false, newError("unknown type in pattern: %s", pattern.Type.Value)
+		}
+		matched := false
+		for _, t := range types {
+			matched = matched || value.IsType(t)
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+
+	if pattern.Name.Value != "_" {
+		env.Set(pattern.Name.Value, value)
+	}
+
+	return true, nil
+}
+
+func matchArrayPattern(pattern *ast.ArrayPattern, value object.Object, env *object.Env) (bool, *object.Error) {
+	array, ok := value.(*object.Array)
+	if !ok {
+		return false, nil
+	}
+
+	if len(array.Elements) < len(pattern.Elements) {
+		return false, nil
+	}
+	if pattern.Rest == nil && len(array.Elements) != len(pattern.Elements) {
+		return false, nil
+	}
+
+	for i, element := range pattern.Elements {
+		matched, err := matchPattern(element, array.Elements[i], env)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+
+	if pattern.Rest != nil && pattern.Rest.Value != "_" {
+		rest := make([]object.Object, len(array.Elements)-len(pattern.Elements))
+		copy(rest, array.Elements[len(pattern.Elements):])
+		env.Set(pattern.Rest.Value, &object.Array{Elements: rest})
+	}
+
+	return true, nil
+}
+
+func matchHashPattern(pattern *ast.HashPattern, value object.Object, env *object.Env) (bool, *object.Error) {
+	hash, ok := value.(*object.Hash)
+	if !ok {
+		return false, nil
+	}
+
+	for _, pair := range pattern.Pairs {
+		key := eval(pair.Key, env)
+		if err, ok := key.(*object.Error); ok {
+			return false, err
+		}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return false, newError("unusable as hash key: %s", key.Type())
+		}
+
+		element, ok := hash.Get(hashKey)
+		if !ok {
+			return false, nil
+		}
+
+		matched, err := matchPattern(pair.Value, element, env)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// evalDestructuringLet binds the names in the pattern of a let statement. The
+// value must match the pattern.
+func evalDestructuringLet(node *ast.LetStatement, env *object.Env) object.Object {
+	val := eval(node.Value, env)
+	if isSignal(val) {
+		return val
+	}
+
+	scope := object.NewChildEnv(env)
+	matched, err := matchPattern(node.Pattern, val, scope)
+	if err != nil {
+		return err
+	}
+	if !matched {
+		return newError("pattern %s does not match %s", node.Pattern, val.Inspect())
+	}
+
+	for _, name := range scope.Names() {
+		if env.IsLocalConst(name) {
+			return newError("cannot redeclare constant: %s", name)
+		}
+	}
+	for _, name := range scope.Names() {
+		value, _ := scope.Get(name)
+		env.Set(name, value)
+	}
+
+	return nil
+}
@@ -1,7 +1,11 @@
 package lexer
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 
@@ -13,32 +17,75 @@ const (
 	EOF = '\uFFFF'
 )
 
-// New creates a new instance of the lexer channel.
+// Mode controls optional lexer behaviour.
+type Mode uint
+
+const (
+	// ScanComments emits comments as COMMENT tokens instead of skipping them.
+	ScanComments Mode = 1 << iota
+)
+
+// New creates a new instance of the lexer.
 func New(input string) *Lexer {
+	return NewFile("", input, 0)
+}
+
+// NewFile creates a new instance of the lexer for the named file. The file
+// name is recorded in the position of each token.
+func NewFile(file string, input string, mode Mode) *Lexer {
 	l := &Lexer{
-		input:  input,
-		Tokens: make(chan token.Token),
+		input: input,
+		file:  file,
+		mode:  mode,
+		line:  1,
+		col:   1,
+		state: lexShebang,
 	}
-	go l.run()
+	l.startPos = l.position()
 	return l
 }
 
 // Lexer is the instance of the lexer.
 type Lexer struct {
-	input  string           // The string being scanned.
-	start  int              // Start position of this item.
-	pos    int              // Current position in the input.
-	width  int              // Width of the last rune read.
-	Tokens chan token.Token // Channel for lexed tokens
+	input    string         // The string being scanned.
+	file     string         // The name of the file being scanned.
+	mode     Mode           // Optional behaviour.
+	start    int            // Start position of this item.
+	startPos token.Position // Source position of the start of this item.
+	pos      int            // Current position in the input.
+	line     int            // Current line in the input.
+	col      int            // Current column in the input.
+	width    int            // Width of the last rune read.
+	state    stateFn        // The next state to run.
+	tokens   []token.Token  // Lexed tokens waiting to be returned.
+	eof      token.Token    // The EOF token, returned once input is exhausted.
 }
 
 type stateFn func(*Lexer) stateFn
 
-func (l *Lexer) run() {
-	for state := lex; state != nil; {
-		state = state(l)
+// NextToken returns the next token from the input. The state machine is only
+// run until it has emitted a token, so input is lexed as it's consumed. Once
+// the input is exhausted, every call returns an EOF token.
+func (l *Lexer) NextToken() token.Token {
+	for len(l.tokens) == 0 {
+		if l.state == nil {
+			return l.eof
+		}
+		l.state = l.state(l)
 	}
-	close(l.Tokens)
+
+	tok := l.tokens[0]
+	l.tokens = l.tokens[:copy(l.tokens, l.tokens[1:])]
+
+	if tok.IsType(token.EOF) {
+		l.eof = tok
+	}
+
+	return tok
+}
+
+func (l *Lexer) push(tok token.Token) {
+	l.tokens = append(l.tokens, tok)
 }
 
 func (l *Lexer) read() string {
@@ -49,12 +96,42 @@ func (l *Lexer) unread() string {
 	return l.input[l.pos:]
 }
 
+func (l *Lexer) position() token.Position {
+	return token.Position{
+		File:   l.file,
+		Offset: l.pos,
+		Line:   l.line,
+		Column: l.col,
+	}
+}
+
 func (l *Lexer) emit(t token.Type) {
-	l.Tokens <- token.Token{
+	l.push(token.Token{
 		Type:    t,
 		Literal: l.read(),
+		Pos:     l.startPos,
+		End:     l.position(),
+	})
+	l.discard()
+}
+
+// emitOperator emits the assignment form of an operator if it's followed by
+// an equals sign.
+func (l *Lexer) emitOperator(t, assign token.Type) {
+	if string(l.peek()) == token.ASSIGN {
+		l.advance()
+		l.emit(assign)
+	} else {
+		l.emit(t)
+	}
+}
+
+func (l *Lexer) emitComment() {
+	if l.mode&ScanComments != 0 {
+		l.emit(token.COMMENT)
+	} else {
+		l.discard()
 	}
-	l.start = l.pos
 }
 
 func (l *Lexer) peek() (r rune) {
@@ -66,6 +143,19 @@ func (l *Lexer) peek() (r rune) {
 	return r
 }
 
+// peekNext returns the rune after the next one without advancing.
+func (l *Lexer) peekNext() (r rune) {
+	if l.pos >= len(l.input) {
+		return EOF
+	}
+	_, width := utf8.DecodeRuneInString(l.unread())
+	if l.pos+width >= len(l.input) {
+		return EOF
+	}
+	r, _ = utf8.DecodeRuneInString(l.input[l.pos+width:])
+	return r
+}
+
 func (l *Lexer) advance() (r rune) {
 	if l.pos >= len(l.input) {
 		l.width = 0
@@ -73,6 +163,12 @@ func (l *Lexer) advance() (r rune) {
 	}
 	r, l.width = utf8.DecodeRuneInString(l.unread())
 	l.pos += l.width
+	if r == '\n' {
+		l.line++
+		l.col = 1
+	} else {
+		l.col++
+	}
 	return r
 }
 
@@ -84,77 +180,163 @@ func (l *Lexer) acceptWhitespace() {
 
 func (l *Lexer) discard() {
 	l.start = l.pos
+	l.startPos = l.position()
 }
 
+// error emits an illegal token describing the problem and carries on lexing
+// after it, so the parser can report more than the first mistake.
 func (l *Lexer) error(text string) stateFn {
-	l.Tokens <- token.Token{
+	l.push(token.Token{
 		Type:    token.ILLEGAL,
-		Literal: fmt.Sprintf("Parse error: %s %.50q", text, l.read()),
-	}
-	return nil
+		Literal: fmt.Sprintf("%s %.50q", text, l.read()),
+		Pos:     l.startPos,
+		End:     l.position(),
+	})
+	l.discard()
+	return lex
 }
 
+// lex emits at most one token before returning, so tokens are only lexed as
+// they are requested.
 func lex(l *Lexer) stateFn {
-	for {
-		l.acceptWhitespace()
-		l.discard()
+	l.acceptWhitespace()
+	l.discard()
 
-		r := l.advance()
-
-		switch string(r) {
-		case token.ASSIGN:
-			return lexAssign
-		case token.ASTERISK:
-			l.emit(token.ASTERISK)
-		case token.BANG:
-			return lexBang
-		case token.COMMA:
-			l.emit(token.COMMA)
-		case token.GT:
-			l.emit(token.GT)
-		case token.LBRACE:
-			l.emit(token.LBRACE)
-		case token.LBRACKET:
-			l.emit(token.LBRACKET)
-		case token.LPAREN:
-			l.emit(token.LPAREN)
-		case token.LT:
-			l.emit(token.LT)
-		case token.MINUS:
-			l.emit(token.MINUS)
-		case token.PLUS:
-			l.emit(token.PLUS)
-		case token.RBRACE:
-			l.emit(token.RBRACE)
-		case token.RBRACKET:
-			l.emit(token.RBRACKET)
-		case token.RPAREN:
-			l.emit(token.RPAREN)
-		case token.SEMICOLON:
-			l.emit(token.SEMICOLON)
-		case token.SLASH:
-			l.emit(token.SLASH)
-		case token.DOUBLE_QUOTE:
-			return lexString
-		case token.EOF:
-			return lexEOF
-		default:
-			if unicode.IsLetter(r) {
-				return lexIdentifier
-			} else if unicode.IsDigit(r) {
-				return lexNumber
-			} else {
-				return l.error("Illegal token.")
+	r := l.advance()
+
+	switch string(r) {
+	case token.ASSIGN:
+		return lexAssign
+	case token.AMPERSAND:
+		return lexAmpersand
+	case token.ASTERISK:
+		return lexAsterisk
+	case token.BANG:
+		return lexBang
+	case token.CARET:
+		l.emitOperator(token.CARET, token.CARET_ASSIGN)
+	case token.COLON:
+		l.emit(token.COLON)
+	case token.COMMA:
+		l.emit(token.COMMA)
+	case token.DOT:
+		if unicode.IsDigit(l.peek()) {
+			return lexNumber
+		}
+		if l.peek() == '.' && l.peekNext() == '.' {
+			l.advance()
+			l.advance()
+			l.emit(token.ELLIPSIS)
+			break
+		}
+		return l.error("illegal token")
+	case token.GT:
+		return lexGreater
+	case token.LBRACE:
+		l.emit(token.LBRACE)
+	case token.LBRACKET:
+		l.emit(token.LBRACKET)
+	case token.LPAREN:
+		l.emit(token.LPAREN)
+	case token.LT:
+		return lexLess
+	case token.MINUS:
+		l.emitOperator(token.MINUS, token.MINUS_ASSIGN)
+	case token.PERCENT:
+		l.emitOperator(token.PERCENT, token.PERCENT_ASSIGN)
+	case token.PIPE:
+		return lexPipe
+	case token.PLUS:
+		l.emitOperator(token.PLUS, token.PLUS_ASSIGN)
+	case token.RBRACE:
+		l.emit(token.RBRACE)
+	case token.RBRACKET:
+		l.emit(token.RBRACKET)
+	case token.RPAREN:
+		l.emit(token.RPAREN)
+	case token.SEMICOLON:
+		l.emit(token.SEMICOLON)
+	case token.SLASH:
+		return lexSlash
+	case token.TILDE:
+		l.emit(token.TILDE)
+	case token.DOUBLE_QUOTE:
+		return lexString
+	case token.EOF:
+		return lexEOF
+	default:
+		if isIdentifierStart(r) {
+			return lexIdentifier
+		} else if unicode.IsDigit(r) {
+			return lexNumber
+		} else {
+			return l.error("illegal token")
+		}
+	}
+
+	return lex
+}
+
+func lexShebang(l *Lexer) stateFn {
+	if strings.HasPrefix(l.input, "#!") {
+		return lexLineComment
+	}
+	return lex
+}
+
+func lexSlash(l *Lexer) stateFn {
+	switch string(l.peek()) {
+	case token.SLASH:
+		return lexLineComment
+	case token.ASTERISK:
+		l.advance()
+		return lexBlockComment
+	default:
+		l.emitOperator(token.SLASH, token.SLASH_ASSIGN)
+		return lex
+	}
+}
+
+func lexLineComment(l *Lexer) stateFn {
+	for r := l.peek(); r != '\n' && r != EOF; r = l.peek() {
+		l.advance()
+	}
+	l.emitComment()
+	return lex
+}
+
+// Block comments nest, so commenting out code containing them works.
+func lexBlockComment(l *Lexer) stateFn {
+	depth := 1
+	for depth > 0 {
+		switch l.advance() {
+		case '/':
+			if l.peek() == '*' {
+				l.advance()
+				depth++
 			}
+		case '*':
+			if l.peek() == '/' {
+				l.advance()
+				depth--
+			}
+		case EOF:
+			return l.error("unterminated comment")
 		}
 	}
+	l.emitComment()
+	return lex
 }
 
 func lexAssign(l *Lexer) stateFn {
-	if string(l.peek()) == token.ASSIGN {
+	switch string(l.peek()) {
+	case token.ASSIGN:
 		l.advance()
 		l.emit(token.EQUAL)
-	} else {
+	case token.GT:
+		l.advance()
+		l.emit(token.ARROW)
+	default:
 		l.emit(token.ASSIGN)
 	}
 	return lex
@@ -170,31 +352,266 @@ func lexBang(l *Lexer) stateFn {
 	return lex
 }
 
+func isIdentifierStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_'
+}
+
+func isIdentifierPart(r rune) bool {
+	return isIdentifierStart(r) || unicode.IsDigit(r)
+}
+
+func lexAsterisk(l *Lexer) stateFn {
+	if string(l.peek()) == token.ASTERISK {
+		l.advance()
+		l.emitOperator(token.POWER, token.POWER_ASSIGN)
+	} else {
+		l.emitOperator(token.ASTERISK, token.ASTERISK_ASSIGN)
+	}
+	return lex
+}
+
+func lexLess(l *Lexer) stateFn {
+	switch string(l.peek()) {
+	case token.ASSIGN:
+		l.advance()
+		l.emit(token.LT_EQUAL)
+	case token.LT:
+		l.advance()
+		l.emitOperator(token.SHIFT_LEFT, token.SHIFT_LEFT_ASSIGN)
+	default:
+		l.emit(token.LT)
+	}
+	return lex
+}
+
+func lexGreater(l *Lexer) stateFn {
+	switch string(l.peek()) {
+	case token.ASSIGN:
+		l.advance()
+		l.emit(token.GT_EQUAL)
+	case token.GT:
+		l.advance()
+		l.emitOperator(token.SHIFT_RIGHT, token.SHIFT_RIGHT_ASSIGN)
+	default:
+		l.emit(token.GT)
+	}
+	return lex
+}
+
+func lexAmpersand(l *Lexer) stateFn {
+	switch string(l.peek()) {
+	case token.AMPERSAND:
+		l.advance()
+		l.emit(token.AND)
+	case token.CARET:
+		l.advance()
+		l.emitOperator(token.AND_NOT, token.AND_NOT_ASSIGN)
+	default:
+		l.emitOperator(token.AMPERSAND, token.AMPERSAND_ASSIGN)
+	}
+	return lex
+}
+
+func lexPipe(l *Lexer) stateFn {
+	if string(l.peek()) == token.PIPE {
+		l.advance()
+		l.emit(token.OR)
+	} else {
+		l.emitOperator(token.PIPE, token.PIPE_ASSIGN)
+	}
+	return lex
+}
+
+// Identifiers start with a letter or underscore, followed by any number of
+// letters, digits or underscores.
 func lexIdentifier(l *Lexer) stateFn {
-	for unicode.IsLetter(l.peek()) {
+	for isIdentifierPart(l.peek()) {
 		l.advance()
 	}
 	l.emit(token.LookupType(l.read()))
 	return lex
 }
 
+// acceptDigits accepts decimal digits and the underscores separating them.
+func (l *Lexer) acceptDigits() {
+	for r := l.peek(); unicode.IsDigit(r) || r == '_'; r = l.peek() {
+		l.advance()
+	}
+}
+
+// acceptAlphanumeric accepts anything that could be mistaken for part of a
+// number, so malformed numbers are reported as a whole.
+func (l *Lexer) acceptAlphanumeric() {
+	for r := l.peek(); unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'; r = l.peek() {
+		l.advance()
+	}
+}
+
+// Numbers follow the Go syntax for integer and decimal floating-point
+// literals, including base prefixes and underscores separating digits.
+// Numbers are integers unless they contain a fraction or an exponent. A
+// fraction must have a digit either side of the point, except when the number
+// starts with it, e.g. '.5'.
 func lexNumber(l *Lexer) stateFn {
-	for unicode.IsDigit(l.peek()) {
+	var typ token.Type = token.INT
+
+	if l.read() == token.DOT {
+		typ = token.FLOAT
+	}
+
+	if l.read() == "0" && strings.ContainsRune("xXoObB", l.peek()) {
+		l.advance()
+		l.acceptAlphanumeric()
+		return l.emitNumber(typ)
+	}
+
+	l.acceptDigits()
+
+	if typ == token.INT && string(l.peek()) == token.DOT && unicode.IsDigit(l.peekNext()) {
+		typ = token.FLOAT
+		l.advance()
+		l.acceptDigits()
+	}
+
+	if r := l.peek(); r == 'e' || r == 'E' {
+		typ = token.FLOAT
 		l.advance()
+		if r := l.peek(); r == '+' || r == '-' {
+			l.advance()
+		}
+		if !unicode.IsDigit(l.peek()) {
+			l.acceptAlphanumeric()
+			return l.error("malformed exponent")
+		}
+		l.acceptDigits()
 	}
-	l.emit(token.INT)
+
+	l.acceptAlphanumeric()
+	return l.emitNumber(typ)
+}
+
+// emitNumber checks the syntax of the number before emitting it. Checking the
+// range of the value is left to the parser.
+func (l *Lexer) emitNumber(typ token.Type) stateFn {
+	literal := l.read()
+
+	switch typ {
+	case token.INT:
+		// Parsing stops at the first overflowing digit, so the syntax of
+		// large integers needs checking separately.
+		_, err := strconv.ParseInt(literal, 0, 64)
+		if errors.Is(err, strconv.ErrRange) {
+			if _, ok := new(big.Int).SetString(literal, 0); !ok {
+				err = strconv.ErrSyntax
+			}
+		}
+		if errors.Is(err, strconv.ErrSyntax) {
+			return l.error("malformed integer")
+		}
+	case token.FLOAT:
+		if _, err := strconv.ParseFloat(literal, 64); errors.Is(err, strconv.ErrSyntax) {
+			return l.error("malformed float")
+		}
+	}
+
+	l.emit(typ)
 	return lex
 }
 
+// The literal of a string token is the raw source between the quotes, escape
+// sequences are decoded by the parser using Unescape.
 func lexString(l *Lexer) stateFn {
-	l.discard()
-	for string(l.peek()) != token.DOUBLE_QUOTE {
-		l.advance()
+	for {
+		switch l.advance() {
+		case '\\':
+			l.advance()
+		case '"':
+			raw := l.read()
+			raw = raw[1 : len(raw)-1]
+
+			if _, err := Unescape(raw); err != nil {
+				return l.error(err.Error())
+			}
+
+			l.push(token.Token{
+				Type:    token.STRING,
+				Literal: raw,
+				Pos:     l.startPos,
+				End:     l.position(),
+			})
+			l.discard()
+			return lex
+		case EOF:
+			return l.error("unterminated string")
+		}
 	}
-	l.emit(token.STRING)
-	l.advance()
-	l.discard()
-	return lex
+}
+
+// Unescape decodes the escape sequences in the raw source of a string. A \x
+// escape is a single byte, whereas \u{...} is the UTF-8 encoding of a code
+// point.
+func Unescape(raw string) (string, error) {
+	if !strings.ContainsRune(raw, '\\') {
+		return raw, nil
+	}
+
+	var out strings.Builder
+
+	for i := 0; i < len(raw); {
+		r, width := utf8.DecodeRuneInString(raw[i:])
+		i += width
+
+		if r != '\\' {
+			out.WriteRune(r)
+			continue
+		}
+
+		if i >= len(raw) {
+			return "", fmt.Errorf("unterminated escape sequence")
+		}
+
+		esc := raw[i]
+		i++
+
+		switch esc {
+		case 'n':
+			out.WriteByte('\n')
+		case 'r':
+			out.WriteByte('\r')
+		case 't':
+			out.WriteByte('\t')
+		case '"':
+			out.WriteByte('"')
+		case '\\':
+			out.WriteByte('\\')
+		case 'x':
+			if i+2 > len(raw) {
+				return "", fmt.Errorf("invalid escape sequence \\x%s", raw[i:])
+			}
+			v, err := strconv.ParseUint(raw[i:i+2], 16, 8)
+			if err != nil {
+				return "", fmt.Errorf("invalid escape sequence \\x%s", raw[i:i+2])
+			}
+			out.WriteByte(byte(v))
+			i += 2
+		case 'u':
+			end := strings.IndexByte(raw[i:], '}')
+			if i >= len(raw) || raw[i] != '{' || end < 0 {
+				return "", fmt.Errorf("invalid escape sequence \\u, expected \\u{...}")
+			}
+			digits := raw[i+1 : i+end]
+			v, err := strconv.ParseUint(digits, 16, 32)
+			if err != nil || len(digits) > 6 || !utf8.ValidRune(rune(v)) {
+				return "", fmt.Errorf("invalid escape sequence \\u{%s}", digits)
+			}
+			out.WriteRune(rune(v))
+			i += end + 1
+		default:
+			return "", fmt.Errorf("invalid escape sequence \\%c", esc)
+		}
+	}
+
+	return out.String(), nil
 }
 
 func lexEOF(l *Lexer) stateFn {
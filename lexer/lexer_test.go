@@ -1,6 +1,7 @@
 package lexer
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/nomad-software/script/token"
@@ -35,7 +36,87 @@ func TestLexingSingleCharacters(t *testing.T) {
 	lexer := New(input)
 
 	for i, test := range tests {
-		tok := <-lexer.Tokens
+		tok := lexer.NextToken()
+
+		if tok.Type != test.typ {
+			t.Fatalf("tests[%d] - token type wrong. expected=%q, got=%q", i, test.typ, tok.Type)
+		}
+
+		if tok.Literal != test.literal {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, test.literal, tok.Literal)
+		}
+	}
+}
+
+func TestLexingOperators(t *testing.T) {
+	input := `<= >= && || % ** < > * & | ^ &^ << >> ~ ...rest`
+
+	tests := []test{
+		{token.LT_EQUAL, "<="},
+		{token.GT_EQUAL, ">="},
+		{token.AND, "&&"},
+		{token.OR, "||"},
+		{token.PERCENT, "%"},
+		{token.POWER, "**"},
+		{token.LT, "<"},
+		{token.GT, ">"},
+		{token.ASTERISK, "*"},
+		{token.AMPERSAND, "&"},
+		{token.PIPE, "|"},
+		{token.CARET, "^"},
+		{token.AND_NOT, "&^"},
+		{token.SHIFT_LEFT, "<<"},
+		{token.SHIFT_RIGHT, ">>"},
+		{token.TILDE, "~"},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "rest"},
+		{token.EOF, ""},
+	}
+
+	lexer := New(input)
+
+	for i, test := range tests {
+		tok := lexer.NextToken()
+
+		if tok.Type != test.typ {
+			t.Fatalf("tests[%d] - token type wrong. expected=%q, got=%q", i, test.typ, tok.Type)
+		}
+
+		if tok.Literal != test.literal {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, test.literal, tok.Literal)
+		}
+	}
+}
+
+func TestLexingAssignmentOperators(t *testing.T) {
+	input := `= += -= *= /= %= **= &= |= ^= &^= <<= >>= == != <= >= =>`
+
+	tests := []test{
+		{token.ASSIGN, "="},
+		{token.PLUS_ASSIGN, "+="},
+		{token.MINUS_ASSIGN, "-="},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.SLASH_ASSIGN, "/="},
+		{token.PERCENT_ASSIGN, "%="},
+		{token.POWER_ASSIGN, "**="},
+		{token.AMPERSAND_ASSIGN, "&="},
+		{token.PIPE_ASSIGN, "|="},
+		{token.CARET_ASSIGN, "^="},
+		{token.AND_NOT_ASSIGN, "&^="},
+		{token.SHIFT_LEFT_ASSIGN, "<<="},
+		{token.SHIFT_RIGHT_ASSIGN, ">>="},
+		{token.EQUAL, "=="},
+		{token.NOT_EQUAL, "!="},
+		{token.LT_EQUAL, "<="},
+		{token.GT_EQUAL, ">="},
+		{token.ARROW, "=>"},
+		{token.EOF, ""},
+	}
+
+	lexer := New(input)
+
+	for i, test := range tests {
+		tok := lexer.NextToken()
 
 		if tok.Type != test.typ {
 			t.Fatalf("tests[%d] - token type wrong. expected=%q, got=%q", i, test.typ, tok.Type)
@@ -62,7 +143,7 @@ func TestLexingVariables(t *testing.T) {
 	lexer := New(input)
 
 	for i, test := range tests {
-		tok := <-lexer.Tokens
+		tok := lexer.NextToken()
 
 		if tok.Type != test.typ {
 			t.Fatalf("tests[%d] - token type wrong. expected=%q, got=%q", i, test.typ, tok.Type)
@@ -76,7 +157,7 @@ func TestLexingVariables(t *testing.T) {
 
 func TestLexingEdgeCases(t *testing.T) {
 	input := `
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 
 10 == 10;
@@ -111,7 +192,7 @@ func TestLexingEdgeCases(t *testing.T) {
 	lexer := New(input)
 
 	for i, test := range tests {
-		tok := <-lexer.Tokens
+		tok := lexer.NextToken()
 
 		if tok.Type != test.typ {
 			t.Fatalf("tests[%d] - token type wrong. expected=%q, got=%q", i, test.typ, tok.Type)
@@ -132,7 +213,7 @@ let add = fn(x, y) {
 };
 
 let result = add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 
 if (5 < 10) {
@@ -146,6 +227,7 @@ if (5 < 10) {
 "foobar"
 "foo bar"
 [1, 2];
+{"foo": "bar"}
 `
 
 	tests := []struct {
@@ -233,18 +315,18 @@ if (5 < 10) {
 		{token.INT, "2"},
 		{token.RBRACKET, "]"},
 		{token.SEMICOLON, ";"},
-		// {token.LBRACE, "{"},
-		// {token.STRING, "foo"},
-		// {token.COLON, ":"},
-		// {token.STRING, "bar"},
-		// {token.RBRACE, "}"},
+		{token.LBRACE, "{"},
+		{token.STRING, "foo"},
+		{token.COLON, ":"},
+		{token.STRING, "bar"},
+		{token.RBRACE, "}"},
 		{token.EOF, ""},
 	}
 
 	l := New(input)
 
 	for i, tt := range tests {
-		tok := <-l.Tokens
+		tok := l.NextToken()
 
 		if tok.Type != tt.expectedType {
 			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
@@ -255,3 +337,399 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestLexingPositions(t *testing.T) {
+	input := "let x = \"ab\";\n  x + 10"
+
+	tests := []struct {
+		typ   token.Type
+		start token.Position
+		end   token.Position
+	}{
+		{token.LET, token.Position{File: "test", Offset: 0, Line: 1, Column: 1}, token.Position{File: "test", Offset: 3, Line: 1, Column: 4}},
+		{token.IDENT, token.Position{File: "test", Offset: 4, Line: 1, Column: 5}, token.Position{File: "test", Offset: 5, Line: 1, Column: 6}},
+		{token.ASSIGN, token.Position{File: "test", Offset: 6, Line: 1, Column: 7}, token.Position{File: "test", Offset: 7, Line: 1, Column: 8}},
+		{token.STRING, token.Position{File: "test", Offset: 8, Line: 1, Column: 9}, token.Position{File: "test", Offset: 12, Line: 1, Column: 13}},
+		{token.SEMICOLON, token.Position{File: "test", Offset: 12, Line: 1, Column: 13}, token.Position{File: "test", Offset: 13, Line: 1, Column: 14}},
+		{token.IDENT, token.Position{File: "test", Offset: 16, Line: 2, Column: 3}, token.Position{File: "test", Offset: 17, Line: 2, Column: 4}},
+		{token.PLUS, token.Position{File: "test", Offset: 18, Line: 2, Column: 5}, token.Position{File: "test", Offset: 19, Line: 2, Column: 6}},
+		{token.INT, token.Position{File: "test", Offset: 20, Line: 2, Column: 7}, token.Position{File: "test", Offset: 22, Line: 2, Column: 9}},
+		{token.EOF, token.Position{File: "test", Offset: 22, Line: 2, Column: 9}, token.Position{File: "test", Offset: 22, Line: 2, Column: 9}},
+	}
+
+	lexer := NewFile("test", input, 0)
+
+	for i, test := range tests {
+		tok := lexer.NextToken()
+
+		if tok.Type != test.typ {
+			t.Fatalf("tests[%d] - token type wrong. expected=%q, got=%q", i, test.typ, tok.Type)
+		}
+
+		if tok.Pos != test.start {
+			t.Fatalf("tests[%d] - start position wrong. expected=%+v, got=%+v", i, test.start, tok.Pos)
+		}
+
+		if tok.End != test.end {
+			t.Fatalf("tests[%d] - end position wrong. expected=%+v, got=%+v", i, test.end, tok.End)
+		}
+	}
+}
+
+func TestLexingComments(t *testing.T) {
+	input := `#!/usr/bin/env script
+// A line comment.
+let a = 1; // Trailing comment.
+/* A block
+   comment. */
+let b = a / 2;
+/* Nested /* block */ comment. */
+b`
+
+	tests := []test{
+		{token.LET, "let"},
+		{token.IDENT, "a"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.LET, "let"},
+		{token.IDENT, "b"},
+		{token.ASSIGN, "="},
+		{token.IDENT, "a"},
+		{token.SLASH, "/"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "b"},
+		{token.EOF, ""},
+	}
+
+	lexer := New(input)
+
+	for i, test := range tests {
+		tok := lexer.NextToken()
+
+		if tok.Type != test.typ {
+			t.Fatalf("tests[%d] - token type wrong. expected=%q, got=%q", i, test.typ, tok.Type)
+		}
+
+		if tok.Literal != test.literal {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, test.literal, tok.Literal)
+		}
+	}
+}
+
+func TestLexingCommentTokens(t *testing.T) {
+	input := "#!/bin/script\n1 // one\n/* two /* three */ */"
+
+	tests := []test{
+		{token.COMMENT, "#!/bin/script"},
+		{token.INT, "1"},
+		{token.COMMENT, "// one"},
+		{token.COMMENT, "/* two /* three */ */"},
+		{token.EOF, ""},
+	}
+
+	lexer := NewFile("", input, ScanComments)
+
+	for i, test := range tests {
+		tok := lexer.NextToken()
+
+		if tok.Type != test.typ {
+			t.Fatalf("tests[%d] - token type wrong. expected=%q, got=%q", i, test.typ, tok.Type)
+		}
+
+		if tok.Literal != test.literal {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, test.literal, tok.Literal)
+		}
+	}
+}
+
+func TestLexingUnterminatedComment(t *testing.T) {
+	input := "1 /* two /* three */"
+
+	lexer := New(input)
+
+	lexer.NextToken()
+	tok := lexer.NextToken()
+
+	if tok.Type != token.ILLEGAL {
+		t.Fatalf("token type wrong. expected=%q, got=%q", token.ILLEGAL, tok.Type)
+	}
+
+	if tok.Pos.Column != 3 {
+		t.Errorf("token column wrong. expected=%d, got=%d", 3, tok.Pos.Column)
+	}
+
+	if tok := lexer.NextToken(); tok.Type != token.EOF {
+		t.Fatalf("token type wrong. expected=%q, got=%q", token.EOF, tok.Type)
+	}
+}
+
+func TestLexingStringEscapes(t *testing.T) {
+	input := `"a\"b" "c\\" "\u{1F600}\x41\n"`
+
+	tests := []test{
+		{token.STRING, `a\"b`},
+		{token.STRING, `c\\`},
+		{token.STRING, `\u{1F600}\x41\n`},
+		{token.EOF, ""},
+	}
+
+	lexer := New(input)
+
+	for i, test := range tests {
+		tok := lexer.NextToken()
+
+		if tok.Type != test.typ {
+			t.Fatalf("tests[%d] - token type wrong. expected=%q, got=%q", i, test.typ, tok.Type)
+		}
+
+		if tok.Literal != test.literal {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, test.literal, tok.Literal)
+		}
+	}
+}
+
+func TestLexingStringErrors(t *testing.T) {
+	tests := []struct {
+		input  string
+		column int
+	}{
+		{`let a = "unterminated`, 9},
+		{`let a = "escaped quote\"`, 9},
+		{`let a = "bad \q escape"`, 9},
+		{`let a = "bad \x4 escape"`, 9},
+		{`let a = "bad \u{110000} escape"`, 9},
+	}
+
+	for _, tt := range tests {
+		lexer := New(tt.input)
+
+		var tok token.Token
+		for tok = lexer.NextToken(); tok.Type != token.ILLEGAL; tok = lexer.NextToken() {
+			if tok.Type == token.EOF {
+				t.Fatalf("%q - no illegal token found", tt.input)
+			}
+		}
+
+		if tok.Pos.Column != tt.column {
+			t.Errorf("%q - column wrong. expected=%d, got=%d", tt.input, tt.column, tok.Pos.Column)
+		}
+
+		for tok.Type != token.EOF {
+			tok = lexer.NextToken()
+		}
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected string
+	}{
+		{`plain`, "plain"},
+		{`a\nb\tc\r`, "a\nb\tc\r"},
+		{`\"quoted\"`, `"quoted"`},
+		{`back\\slash`, `back\slash`},
+		{`\x41\x62`, "Ab"},
+		{`\xff`, "\xff"},
+		{`\xc3\xa9t\xc3\xa9`, "été"},
+		{`\u{1F600}`, "😀"},
+		{`\u{e9}t\u{E9}`, "été"},
+	}
+
+	for _, tt := range tests {
+		value, err := Unescape(tt.raw)
+		if err != nil {
+			t.Errorf("%q - unexpected error: %s", tt.raw, err)
+			continue
+		}
+
+		if value != tt.expected {
+			t.Errorf("%q - value wrong. expected=%q, got=%q", tt.raw, tt.expected, value)
+		}
+	}
+}
+
+func TestLexingFloats(t *testing.T) {
+	input := `3.14 1e-9 .5 2E+3 10.0e2 7 1.x`
+
+	tests := []test{
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, ".5"},
+		{token.FLOAT, "2E+3"},
+		{token.FLOAT, "10.0e2"},
+		{token.INT, "7"},
+		{token.INT, "1"},
+		{token.ILLEGAL, `illegal token "."`},
+		{token.IDENT, "x"},
+		{token.EOF, ""},
+	}
+
+	lexer := New(input)
+
+	for i, test := range tests {
+		tok := lexer.NextToken()
+
+		if tok.Type != test.typ {
+			t.Fatalf("tests[%d] - token type wrong. expected=%q, got=%q", i, test.typ, tok.Type)
+		}
+
+		if tok.Literal != test.literal {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, test.literal, tok.Literal)
+		}
+	}
+}
+
+func TestLexingIntegerLiterals(t *testing.T) {
+	input := `0x1F 0XfF 0o17 0O7 017 0b1010 0B1 1_000_000 0x_FF_FF 0 1_000.5`
+
+	tests := []test{
+		{token.INT, "0x1F"},
+		{token.INT, "0XfF"},
+		{token.INT, "0o17"},
+		{token.INT, "0O7"},
+		{token.INT, "017"},
+		{token.INT, "0b1010"},
+		{token.INT, "0B1"},
+		{token.INT, "1_000_000"},
+		{token.INT, "0x_FF_FF"},
+		{token.INT, "0"},
+		{token.FLOAT, "1_000.5"},
+		{token.EOF, ""},
+	}
+
+	lexer := New(input)
+
+	for i, test := range tests {
+		tok := lexer.NextToken()
+
+		if tok.Type != test.typ {
+			t.Fatalf("tests[%d] - token type wrong. expected=%q, got=%q", i, test.typ, tok.Type)
+		}
+
+		if tok.Literal != test.literal {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, test.literal, tok.Literal)
+		}
+	}
+}
+
+func TestLexingMalformedNumbers(t *testing.T) {
+	tests := []struct {
+		input   string
+		literal string
+	}{
+		{"x = 0xZZ;", `malformed integer "0xZZ"`},
+		{"x = 0x;", `malformed integer "0x"`},
+		{"x = 1_;", `malformed integer "1_"`},
+		{"x = 1__0;", `malformed integer "1__0"`},
+		{"x = 0b102;", `malformed integer "0b102"`},
+		{"x = 0o8;", `malformed integer "0o8"`},
+		{"x = 09;", `malformed integer "09"`},
+		{"x = 12abc;", `malformed integer "12abc"`},
+		{"x = 1e;", `malformed exponent "1e"`},
+		{"x = 1.5_;", `malformed float "1.5_"`},
+		{"x = 99999999999999999999z;", `malformed integer "99999999999999999999z"`},
+	}
+
+	for _, tt := range tests {
+		lexer := New(tt.input)
+
+		lexer.NextToken()
+		lexer.NextToken()
+		tok := lexer.NextToken()
+
+		if tok.Type != token.ILLEGAL {
+			t.Fatalf("%q - token type wrong. expected=%q, got=%q", tt.input, token.ILLEGAL, tok.Type)
+		}
+
+		if tok.Literal != tt.literal {
+			t.Errorf("%q - literal wrong. expected=%q, got=%q", tt.input, tt.literal, tok.Literal)
+		}
+
+		if tok.Pos.Column != 5 {
+			t.Errorf("%q - column wrong. expected=%d, got=%d", tt.input, 5, tok.Pos.Column)
+		}
+
+		if tok := lexer.NextToken(); tok.Type != token.SEMICOLON {
+			t.Errorf("%q - lexing did not resume after the number. got=%q", tt.input, tok.Type)
+		}
+	}
+}
+
+func TestLexingIdentifiers(t *testing.T) {
+	input := `user_id item2 _private __x9 café λ_1 let2 fn_ if`
+
+	tests := []test{
+		{token.IDENT, "user_id"},
+		{token.IDENT, "item2"},
+		{token.IDENT, "_private"},
+		{token.IDENT, "__x9"},
+		{token.IDENT, "café"},
+		{token.IDENT, "λ_1"},
+		{token.IDENT, "let2"},
+		{token.IDENT, "fn_"},
+		{token.IF, "if"},
+		{token.EOF, ""},
+	}
+
+	lexer := New(input)
+
+	for i, test := range tests {
+		tok := lexer.NextToken()
+
+		if tok.Type != test.typ {
+			t.Fatalf("tests[%d] - token type wrong. expected=%q, got=%q", i, test.typ, tok.Type)
+		}
+
+		if tok.Literal != test.literal {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, test.literal, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenAfterEOF(t *testing.T) {
+	lexer := New("x")
+
+	lexer.NextToken()
+
+	for i := 0; i < 3; i++ {
+		tok := lexer.NextToken()
+		if tok.Type != token.EOF {
+			t.Fatalf("call %d - token type wrong. expected=%q, got=%q", i, token.EOF, tok.Type)
+		}
+		if tok.Pos.Column != 2 {
+			t.Fatalf("call %d - column wrong. expected=%d, got=%d", i, 2, tok.Pos.Column)
+		}
+	}
+}
+
+const benchmarkSource = `// Compute some values.
+let fibonacci = fn(x) {
+	if (x < 2) { return x; }
+	fibonacci(x - 1) + fibonacci(x - 2);
+};
+
+let data = {"name": "report", "ratio": 0.75, "mask": 0xFF_FF, "items": [1, 2, 3]};
+let message = "total:\t" + "\u{1F600}";
+`
+
+func benchmarkLexer(b *testing.B, input string) {
+	b.SetBytes(int64(len(input)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		l := New(input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+	}
+}
+
+func BenchmarkLexerSmall(b *testing.B) {
+	benchmarkLexer(b, benchmarkSource)
+}
+
+func BenchmarkLexerLarge(b *testing.B) {
+	benchmarkLexer(b, strings.Repeat(benchmarkSource, 1000))
+}
@@ -2,14 +2,53 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 
+	"github.com/nomad-software/script/diagnostic"
+	"github.com/nomad-software/script/evaluator"
+	"github.com/nomad-software/script/lexer"
+	"github.com/nomad-software/script/object"
+	"github.com/nomad-software/script/parser"
 	"github.com/nomad-software/script/repl"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(run(os.Args[1]))
+	}
+
 	fmt.Println("Script programming language v0.1")
 	fmt.Println("Type Ctrl+C to exit...")
 
 	repl.Start(os.Stdin, os.Stdout)
 }
+
+// run executes a script file, reporting any errors to stderr. It returns the
+// exit status of the program.
+func run(file string) int {
+	source, err := os.ReadFile(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	l := lexer.NewFile(file, string(source), 0)
+	p := parser.New(l)
+
+	program := p.Parse()
+
+	if len(p.Errors()) != 0 {
+		diagnostic.Render(os.Stderr, string(source), p.Errors()...)
+		return 1
+	}
+
+	evaluated := evaluator.Eval(program, object.NewEnv())
+	if err, ok := evaluated.(*object.Error); ok {
+		diagnostic.Render(os.Stderr, string(source), err.Diagnostic())
+		io.WriteString(os.Stderr, err.StackTrace())
+		return 1
+	}
+
+	return 0
+}
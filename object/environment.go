@@ -1,30 +1,150 @@
 package object
 
+import (
+	"sort"
+
+	"github.com/nomad-software/script/token"
+)
+
 func NewChildEnv(parent *Env) *Env {
 	env := NewEnv()
 	env.parent = parent
+	env.frame = parent.frame
+	env.options = parent.options
+	return env
+}
+
+// NewCallEnv creates the scope of a function call, which encloses the scope
+// the function was defined in, but runs in a new frame of the call stack.
+func NewCallEnv(closure *Env, frame *Frame) *Env {
+	env := NewEnv()
+	env.parent = closure
+	env.frame = frame
+	env.options = closure.options
 	return env
 }
 
 func NewEnv() *Env {
-	s := make(map[string]Object)
-	return &Env{state: s, parent: nil}
+	return NewEnvWithOptions(Options{MaxCallDepth: DefaultMaxCallDepth})
+}
+
+// NewEnvWithOptions creates a top level scope which evaluates scripts using
+// the given options. Every scope enclosed by it shares them.
+func NewEnvWithOptions(options Options) *Env {
+	s := make(map[string]binding)
+	return &Env{state: s, parent: nil, options: &options}
+}
+
+// DefaultMaxCallDepth is the call depth allowed by NewEnv.
+const DefaultMaxCallDepth = 10000
+
+// Options configure the evaluation of a script.
+type Options struct {
+	// CheckedArithmetic causes integer overflow to be reported as an error
+	// rather than promoting the result to a big integer.
+	CheckedArithmetic bool
+
+	// MaxCallDepth is the number of nested function calls allowed before a
+	// stack overflow error is reported, or zero for no limit. Tail calls
+	// don't count towards it.
+	MaxCallDepth int
+}
+
+type binding struct {
+	value    Object
+	constant bool
 }
 
 type Env struct {
-	state  map[string]Object
-	parent *Env
+	state   map[string]binding
+	parent  *Env
+	frame   *Frame // nil at the top level of a script
+	options *Options
+}
+
+// Frame is a function call on the call stack.
+type Frame struct {
+	Function string         // The name of the function, empty if anonymous.
+	Call     token.Position // Where the function was called from.
+	Caller   *Frame         // The frame the call was made in, nil at the top level.
+	Depth    int            // The number of frames on the stack, including this one.
+}
+
+// Options returns the options the scope is evaluated with.
+func (e *Env) Options() Options {
+	return *e.options
+}
+
+// Frame returns the call stack frame the scope belongs to.
+func (e *Env) Frame() *Frame {
+	return e.frame
 }
 
 func (e *Env) Get(name string) (Object, bool) {
-	obj, ok := e.state[name]
+	b, ok := e.state[name]
 	if !ok && e.parent != nil {
-		obj, ok = e.parent.Get(name)
+		return e.parent.Get(name)
 	}
-	return obj, ok
+	return b.value, ok
 }
 
 func (e *Env) Set(name string, obj Object) Object {
-	e.state[name] = obj
+	e.state[name] = binding{value: obj}
 	return obj
 }
+
+// SetConst binds an object which can't be reassigned.
+func (e *Env) SetConst(name string, obj Object) Object {
+	e.state[name] = binding{value: obj, constant: true}
+	return obj
+}
+
+// IsConst checks if the nearest binding of the name is a constant.
+func (e *Env) IsConst(name string) bool {
+	for env := e; env != nil; env = env.parent {
+		if b, ok := env.state[name]; ok {
+			return b.constant
+		}
+	}
+	return false
+}
+
+// IsLocalConst checks if the name is bound to a constant in this scope,
+// ignoring any parent scopes.
+func (e *Env) IsLocalConst(name string) bool {
+	return e.state[name].constant
+}
+
+// Names returns the sorted names bound in this scope, ignoring any parent
+// scopes.
+func (e *Env) Names() []string {
+	names := make([]string, 0, len(e.state))
+	for name := range e.state {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Copy creates a scope with the same bindings and parent, which can be changed
+// without affecting this one.
+func (e *Env) Copy() *Env {
+	env := NewChildEnv(e.parent)
+	for name, b := range e.state {
+		env.state[name] = b
+	}
+	return env
+}
+
+// Assign updates an existing binding in the nearest scope which declares it,
+// reporting false if there isn't one.
+func (e *Env) Assign(name string, obj Object) bool {
+	for env := e; env != nil; env = env.parent {
+		if b, ok := env.state[name]; ok {
+			b.value = obj
+			env.state[name] = b
+			return true
+		}
+	}
+	return false
+}
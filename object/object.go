@@ -3,9 +3,14 @@ package object
 import (
 	"bytes"
 	"fmt"
+	"hash/fnv"
+	"math/big"
+	"strconv"
 	"strings"
 
 	"github.com/nomad-software/script/ast"
+	"github.com/nomad-software/script/diagnostic"
+	"github.com/nomad-software/script/token"
 )
 
 type Type string
@@ -14,18 +19,40 @@ const (
 	NULL         = "NULL"
 	ERROR        = "ERROR"
 	INTEGER      = "INTEGER"
+	FLOAT        = "FLOAT"
 	BOOLEAN      = "BOOLEAN"
 	RETURN_VALUE = "RETURN_VALUE"
+	BREAK        = "BREAK"
+	CONTINUE     = "CONTINUE"
+	TAIL_CALL    = "TAIL_CALL"
 	FUNCTION     = "FUNCTION"
 	STRING       = "STRING"
 	BUILTIN      = "BUILTIN"
 	ARRAY        = "ARRAY"
+	HASH         = "HASH"
 )
 
 type Object interface {
 	Type() Type
 	Inspect() string
 	IsType(Type) bool
+	Equal(Object) bool
+}
+
+// HashKey is the key used to store an object in a hash.
+type HashKey struct {
+	Type  Type
+	Value uint64
+	Text  string // The exact value of keys which Value can't hold.
+}
+
+// Big integers are keyed by their exact value, apart from regular integers.
+const bigIntKey Type = "BIG_INTEGER"
+
+// Hashable is implemented by objects which can be used as hash keys.
+type Hashable interface {
+	Object
+	HashKey() HashKey
 }
 
 type Integer struct {
@@ -35,6 +62,87 @@ type Integer struct {
 func (i *Integer) Type() Type             { return INTEGER }
 func (i *Integer) Inspect() string        { return fmt.Sprintf("%d", i.Value) }
 func (i *Integer) IsType(other Type) bool { return i.Type() == other }
+func (i *Integer) HashKey() HashKey       { return HashKey{Type: i.Type(), Value: uint64(i.Value)} }
+func (i *Integer) Equal(other Object) bool {
+	switch other := other.(type) {
+	case *Integer:
+		return i.Value == other.Value
+	case *Float:
+		return other.Equal(i)
+	default:
+		return false
+	}
+}
+
+// BigInt is an integer too large to be stored in an Integer. It is the same
+// type as far as scripts are concerned.
+type BigInt struct {
+	Value *big.Int
+}
+
+// NewInteger returns the value as an Integer when it fits into one, otherwise
+// as a BigInt.
+func NewInteger(value *big.Int) Object {
+	if value.IsInt64() {
+		return &Integer{Value: value.Int64()}
+	}
+	return &BigInt{Value: value}
+}
+
+func (b *BigInt) Type() Type             { return INTEGER }
+func (b *BigInt) Inspect() string        { return b.Value.String() }
+func (b *BigInt) IsType(other Type) bool { return b.Type() == other }
+
+// A big integer never holds a value which fits into an Integer, so the two
+// can't be equal and their keys are kept apart.
+func (b *BigInt) HashKey() HashKey {
+	return HashKey{Type: bigIntKey, Text: b.Value.String()}
+}
+
+func (b *BigInt) Equal(other Object) bool {
+	switch other := other.(type) {
+	case *BigInt:
+		return b.Value.Cmp(other.Value) == 0
+	case *Float:
+		return other.Equal(b)
+	default:
+		return false
+	}
+}
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() Type             { return FLOAT }
+func (f *Float) IsType(other Type) bool { return f.Type() == other }
+
+// Floats compare equal to integers of the same value, matching the promotion
+// rules of arithmetic.
+func (f *Float) Equal(other Object) bool {
+	switch other := other.(type) {
+	case *Float:
+		return f.Value == other.Value
+	case *Integer:
+		return f.Value == float64(other.Value)
+	case *BigInt:
+		v, _ := new(big.Float).SetInt(other.Value).Float64()
+		return f.Value == v
+	default:
+		return false
+	}
+}
+
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+
+	// Always show that this is a float, even when it's a whole number.
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+
+	return s
+}
 
 type Boolean struct {
 	Value bool
@@ -43,38 +151,139 @@ type Boolean struct {
 func (b *Boolean) Type() Type             { return BOOLEAN }
 func (b *Boolean) Inspect() string        { return fmt.Sprintf("%t", b.Value) }
 func (b *Boolean) IsType(other Type) bool { return b.Type() == other }
+func (b *Boolean) Equal(other Object) bool {
+	o, ok := other.(*Boolean)
+	return ok && b.Value == o.Value
+}
+func (b *Boolean) HashKey() HashKey {
+	if b.Value {
+		return HashKey{Type: b.Type(), Value: 1}
+	}
+	return HashKey{Type: b.Type(), Value: 0}
+}
 
 type Null struct {
 }
 
-func (n *Null) Type() Type             { return NULL }
-func (n *Null) Inspect() string        { return "null" }
-func (n *Null) IsType(other Type) bool { return n.Type() == other }
+func (n *Null) Type() Type              { return NULL }
+func (n *Null) Inspect() string         { return "null" }
+func (n *Null) IsType(other Type) bool  { return n.Type() == other }
+func (n *Null) Equal(other Object) bool { return other.IsType(NULL) }
 
 type ReturnValue struct {
 	Value Object
 }
 
-func (rv *ReturnValue) Type() Type             { return RETURN_VALUE }
-func (rv *ReturnValue) Inspect() string        { return rv.Value.Inspect() }
-func (rv *ReturnValue) IsType(other Type) bool { return rv.Type() == other }
+func (rv *ReturnValue) Type() Type              { return RETURN_VALUE }
+func (rv *ReturnValue) Inspect() string         { return rv.Value.Inspect() }
+func (rv *ReturnValue) IsType(other Type) bool  { return rv.Type() == other }
+func (rv *ReturnValue) Equal(other Object) bool { return rv == other }
+
+// Break signals that the innermost loop should stop.
+type Break struct {
+}
+
+func (b *Break) Type() Type              { return BREAK }
+func (b *Break) Inspect() string         { return "break" }
+func (b *Break) IsType(other Type) bool  { return b.Type() == other }
+func (b *Break) Equal(other Object) bool { return b == other }
+
+// Continue signals that the innermost loop should start its next iteration.
+type Continue struct {
+}
+
+func (c *Continue) Type() Type              { return CONTINUE }
+func (c *Continue) Inspect() string         { return "continue" }
+func (c *Continue) IsType(other Type) bool  { return c.Type() == other }
+func (c *Continue) Equal(other Object) bool { return c == other }
+
+// TailCall signals that the current function call should be replaced by a
+// call of another function, with its arguments already bound into Env.
+type TailCall struct {
+	Function *Function
+	Env      *Env
+}
+
+func (tc *TailCall) Type() Type              { return TAIL_CALL }
+func (tc *TailCall) Inspect() string         { return "tail call" }
+func (tc *TailCall) IsType(other Type) bool  { return tc.Type() == other }
+func (tc *TailCall) Equal(other Object) bool { return tc == other }
 
 type Error struct {
 	Message string
+	Kind    string     // Classifies the error, "runtime" for those raised by the interpreter.
+	Payload Object     // An optional value thrown along with the error.
+	Span    token.Span // The source range that caused the error.
+	Stack   *Frame     // The call stack when the error was raised.
 }
 
-func (e *Error) Type() Type             { return ERROR }
-func (e *Error) Inspect() string        { return "ERROR: " + e.Message }
-func (e *Error) IsType(other Type) bool { return e.Type() == other }
+func (e *Error) Type() Type              { return ERROR }
+func (e *Error) IsType(other Type) bool  { return e.Type() == other }
+func (e *Error) Equal(other Object) bool { return e == other }
+func (e *Error) Inspect() string {
+	if e.Span.Start.IsValid() {
+		return "ERROR: " + e.Span.Start.String() + ": " + e.Message
+	}
+	return "ERROR: " + e.Message
+}
+
+// The number of calls shown in a stack trace before the rest are elided.
+const maxTraceFrames = 100
+
+// StackTrace renders the call stack when the error was raised, innermost call
+// first, with the position being executed in each function. It's empty if the
+// error wasn't raised within a function.
+//
+//	stack trace:
+//	divide()
+//		2:25
+//	<script>
+//		4:1
+func (e *Error) StackTrace() string {
+	if e.Stack == nil {
+		return ""
+	}
+
+	var out bytes.Buffer
+
+	out.WriteString("stack trace:\n")
+
+	pos := e.Span.Start
+	shown := 0
+	for frame := e.Stack; frame != nil; frame = frame.Caller {
+		if shown == maxTraceFrames {
+			out.WriteString("...additional frames elided...\n")
+			return out.String()
+		}
+		shown++
+
+		name := frame.Function
+		if name == "" {
+			name = "<anonymous>"
+		}
+		fmt.Fprintf(&out, "%s()\n\t%s\n", name, pos)
+		pos = frame.Call
+	}
+	fmt.Fprintf(&out, "<script>\n\t%s\n", pos)
+
+	return out.String()
+}
+
+// Diagnostic converts the error into a diagnostic for reporting.
+func (e *Error) Diagnostic() *diagnostic.Diagnostic {
+	return diagnostic.New(diagnostic.RuntimeError, e.Span, "%s", e.Message)
+}
 
 type Function struct {
-	Parameters []*ast.Identifier
+	Name       string // The name the function was bound to, if any.
+	Parameters []*ast.Parameter
 	Body       *ast.BlockStatement
 	Env        *Env
 }
 
-func (f *Function) Type() Type             { return FUNCTION }
-func (f *Function) IsType(other Type) bool { return f.Type() == other }
+func (f *Function) Type() Type              { return FUNCTION }
+func (f *Function) IsType(other Type) bool  { return f.Type() == other }
+func (f *Function) Equal(other Object) bool { return f == other }
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
 
@@ -100,21 +309,30 @@ type String struct {
 func (s *String) Type() Type             { return STRING }
 func (s *String) Inspect() string        { return s.Value }
 func (s *String) IsType(other Type) bool { return s.Type() == other }
+func (s *String) Equal(other Object) bool {
+	o, ok := other.(*String)
+	return ok && s.Value == o.Value
+}
 
-// func (s *String) HashKey() HashKey {
-// 	h := fnv.New64a()
-// 	h.Write([]byte(s.Value))
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
 
-// 	return HashKey{Type: s.Type(), Value: h.Sum64()}
-// }
+	return HashKey{Type: s.Type(), Value: h.Sum64(), Text: s.Value}
+}
 
+// Builtin is a function implemented in Go. Named arguments are passed to it
+// separately from the positional ones, and only those listed in Names are
+// accepted.
 type Builtin struct {
-	Fn func(args ...Object) Object
+	Fn    func(args []Object, named map[string]Object) Object
+	Names []string
 }
 
-func (b *Builtin) Type() Type             { return BUILTIN }
-func (b *Builtin) Inspect() string        { return "builtin function" }
-func (b *Builtin) IsType(other Type) bool { return b.Type() == other }
+func (b *Builtin) Type() Type              { return BUILTIN }
+func (b *Builtin) Inspect() string         { return "builtin function" }
+func (b *Builtin) IsType(other Type) bool  { return b.Type() == other }
+func (b *Builtin) Equal(other Object) bool { return b == other }
 
 type Array struct {
 	Elements []Object
@@ -122,43 +340,195 @@ type Array struct {
 
 func (ao *Array) Type() Type             { return ARRAY }
 func (ao *Array) IsType(other Type) bool { return ao.Type() == other }
+func (ao *Array) Equal(other Object) bool {
+	return deepEqual(ao, other, map[comparison]bool{})
+}
 func (ao *Array) Inspect() string {
+	return inspect(ao, map[Object]bool{})
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash is a dictionary of hashable keys to values. It remembers the order in
+// which keys were first inserted.
+type Hash struct {
+	pairs map[HashKey]HashPair
+	keys  []HashKey
+}
+
+// NewHash creates a new empty hash.
+func NewHash() *Hash {
+	return &Hash{pairs: make(map[HashKey]HashPair)}
+}
+
+func (h *Hash) Type() Type             { return HASH }
+func (h *Hash) IsType(other Type) bool { return h.Type() == other }
+
+// Hashes are equal when they contain equal pairs, regardless of order.
+func (h *Hash) Equal(other Object) bool {
+	return deepEqual(h, other, map[comparison]bool{})
+}
+func (h *Hash) Inspect() string {
+	return inspect(h, map[Object]bool{})
+}
+
+// inspect renders arrays and hashes element by element. A container which
+// contains itself is shown as '[...]' or '{...}' where it recurs.
+func inspect(obj Object, inspecting map[Object]bool) string {
 	var out bytes.Buffer
 
-	elements := []string{}
-	for _, e := range ao.Elements {
-		elements = append(elements, e.Inspect())
+	switch obj := obj.(type) {
+	case *Array:
+		if inspecting[obj] {
+			return "[...]"
+		}
+		inspecting[obj] = true
+		defer delete(inspecting, obj)
+
+		elements := []string{}
+		for _, e := range obj.Elements {
+			elements = append(elements, inspect(e, inspecting))
+		}
+
+		out.WriteString("[")
+		out.WriteString(strings.Join(elements, ", "))
+		out.WriteString("]")
+
+	case *Hash:
+		if inspecting[obj] {
+			return "{...}"
+		}
+		inspecting[obj] = true
+		defer delete(inspecting, obj)
+
+		pairs := []string{}
+		for _, pair := range obj.Pairs() {
+			pairs = append(pairs, fmt.Sprintf("%s: %s",
+				pair.Key.Inspect(), inspect(pair.Value, inspecting)))
+		}
+
+		out.WriteString("{")
+		out.WriteString(strings.Join(pairs, ", "))
+		out.WriteString("}")
+
+	default:
+		return obj.Inspect()
 	}
 
-	out.WriteString("[")
-	out.WriteString(strings.Join(elements, ", "))
-	out.WriteString("]")
-
 	return out.String()
 }
 
-// type HashPair struct {
-// 	Key   Object
-// 	Value Object
-// }
+// comparison is a pair of containers being compared by deepEqual.
+type comparison struct {
+	left, right Object
+}
 
-// type Hash struct {
-// 	Pairs map[HashKey]HashPair
-// }
+// deepEqual compares arrays and hashes element by element. A container is
+// always equal to itself, while a pair of distinct containers met again whilst
+// they are still being compared is a cycle, and is reported as unequal rather
+// than recursing forever.
+func deepEqual(left, right Object, comparing map[comparison]bool) bool {
+	switch l := left.(type) {
+	case *Array:
+		r, ok := right.(*Array)
+		if !ok || len(l.Elements) != len(r.Elements) {
+			return false
+		}
+		if l == r {
+			return true
+		}
+		if !compare(l, r, comparing) {
+			return false
+		}
+		defer delete(comparing, comparison{l, r})
+
+		for i, e := range l.Elements {
+			if !deepEqual(e, r.Elements[i], comparing) {
+				return false
+			}
+		}
+		return true
+
+	case *Hash:
+		r, ok := right.(*Hash)
+		if !ok || l.Len() != r.Len() {
+			return false
+		}
+		if l == r {
+			return true
+		}
+		if !compare(l, r, comparing) {
+			return false
+		}
+		defer delete(comparing, comparison{l, r})
+
+		for k, pair := range l.pairs {
+			otherPair, ok := r.pairs[k]
+			if !ok || !deepEqual(pair.Value, otherPair.Value, comparing) {
+				return false
+			}
+		}
+		return true
+	}
 
-// func (h *Hash) Type() Type { return HASH }
-// func (h *Hash) Inspect() string {
-// 	var out bytes.Buffer
+	return left.Equal(right)
+}
 
-// 	pairs := []string{}
-// 	for _, pair := range h.Pairs {
-// 		pairs = append(pairs, fmt.Sprintf("%s: %s",
-// 			pair.Key.Inspect(), pair.Value.Inspect()))
-// 	}
+// compare records that the containers are being compared, reporting false if
+// they already are.
+func compare(left, right Object, comparing map[comparison]bool) bool {
+	c := comparison{left, right}
+	if comparing[c] {
+		return false
+	}
+	comparing[c] = true
+	return true
+}
 
-// 	out.WriteString("{")
-// 	out.WriteString(strings.Join(pairs, ", "))
-// 	out.WriteString("}")
+// Len returns the number of pairs in the hash.
+func (h *Hash) Len() int {
+	return len(h.keys)
+}
 
-// 	return out.String()
-// }
+// Get returns the value stored against the key.
+func (h *Hash) Get(key Hashable) (Object, bool) {
+	pair, ok := h.pairs[key.HashKey()]
+	return pair.Value, ok
+}
+
+// Set stores the value against the key.
+func (h *Hash) Set(key Hashable, value Object) {
+	k := key.HashKey()
+	if _, ok := h.pairs[k]; !ok {
+		h.keys = append(h.keys, k)
+	}
+	h.pairs[k] = HashPair{Key: key, Value: value}
+}
+
+// Delete removes the key from the hash, reporting if it was present.
+func (h *Hash) Delete(key Hashable) bool {
+	k := key.HashKey()
+	if _, ok := h.pairs[k]; !ok {
+		return false
+	}
+	delete(h.pairs, k)
+	for i, other := range h.keys {
+		if other == k {
+			h.keys = append(h.keys[:i], h.keys[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Pairs returns the pairs of the hash in insertion order.
+func (h *Hash) Pairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.keys))
+	for _, k := range h.keys {
+		pairs = append(pairs, h.pairs[k])
+	}
+	return pairs
+}
@@ -1,10 +1,12 @@
 package parser
 
 import (
-	"fmt"
+	"errors"
+	"math/big"
 	"strconv"
 
 	"github.com/nomad-software/script/ast"
+	"github.com/nomad-software/script/diagnostic"
 	"github.com/nomad-software/script/lexer"
 	"github.com/nomad-software/script/precedence"
 	"github.com/nomad-software/script/token"
@@ -17,33 +19,63 @@ type infixFn func(ast.Expression) ast.Expression
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		lexer:     l,
-		errors:    []string{},
+		errors:    []*diagnostic.Diagnostic{},
 		prefixFns: make(map[token.Type]prefixFn),
 		infixFns:  make(map[token.Type]infixFn),
 	}
 
 	p.registerPrefixFn(token.BANG, p.parsePrefixExpression)
 	p.registerPrefixFn(token.FALSE, p.parseBoolean)
+	p.registerPrefixFn(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefixFn(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefixFn(token.IDENT, p.parseIdentifier)
 	p.registerPrefixFn(token.IF, p.parseIfExpression)
+	p.registerPrefixFn(token.LBRACE, p.parseHashLiteral)
 	p.registerPrefixFn(token.INT, p.parseIntegerLiteral)
 	p.registerPrefixFn(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefixFn(token.LPAREN, p.parseGroupedExpression)
+	p.registerPrefixFn(token.MATCH, p.parseMatchExpression)
+	p.registerPrefixFn(token.TRY, p.parseTryExpression)
 	p.registerPrefixFn(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefixFn(token.STRING, p.parseStringLiteral)
+	p.registerPrefixFn(token.TILDE, p.parsePrefixExpression)
 	p.registerPrefixFn(token.TRUE, p.parseBoolean)
 
+	p.registerInfixFn(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfixFn(token.AMPERSAND_ASSIGN, p.parseAssignExpression)
+	p.registerInfixFn(token.AND, p.parseInfixExpression)
+	p.registerInfixFn(token.AND_NOT, p.parseInfixExpression)
+	p.registerInfixFn(token.AND_NOT_ASSIGN, p.parseAssignExpression)
+	p.registerInfixFn(token.ASSIGN, p.parseAssignExpression)
 	p.registerInfixFn(token.ASTERISK, p.parseInfixExpression)
+	p.registerInfixFn(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfixFn(token.CARET, p.parseInfixExpression)
+	p.registerInfixFn(token.CARET_ASSIGN, p.parseAssignExpression)
 	p.registerInfixFn(token.EQUAL, p.parseInfixExpression)
 	p.registerInfixFn(token.GT, p.parseInfixExpression)
+	p.registerInfixFn(token.GT_EQUAL, p.parseInfixExpression)
 	p.registerInfixFn(token.LBRACKET, p.parseIndexExpression)
 	p.registerInfixFn(token.LPAREN, p.parseCallExpression)
 	p.registerInfixFn(token.LT, p.parseInfixExpression)
+	p.registerInfixFn(token.LT_EQUAL, p.parseInfixExpression)
 	p.registerInfixFn(token.MINUS, p.parseInfixExpression)
+	p.registerInfixFn(token.MINUS_ASSIGN, p.parseAssignExpression)
 	p.registerInfixFn(token.NOT_EQUAL, p.parseInfixExpression)
+	p.registerInfixFn(token.OR, p.parseInfixExpression)
+	p.registerInfixFn(token.PERCENT, p.parseInfixExpression)
+	p.registerInfixFn(token.PERCENT_ASSIGN, p.parseAssignExpression)
+	p.registerInfixFn(token.PIPE, p.parseInfixExpression)
+	p.registerInfixFn(token.PIPE_ASSIGN, p.parseAssignExpression)
 	p.registerInfixFn(token.PLUS, p.parseInfixExpression)
+	p.registerInfixFn(token.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfixFn(token.POWER, p.parseInfixExpression)
+	p.registerInfixFn(token.POWER_ASSIGN, p.parseAssignExpression)
+	p.registerInfixFn(token.SHIFT_LEFT, p.parseInfixExpression)
+	p.registerInfixFn(token.SHIFT_LEFT_ASSIGN, p.parseAssignExpression)
+	p.registerInfixFn(token.SHIFT_RIGHT, p.parseInfixExpression)
+	p.registerInfixFn(token.SHIFT_RIGHT_ASSIGN, p.parseAssignExpression)
 	p.registerInfixFn(token.SLASH, p.parseInfixExpression)
+	p.registerInfixFn(token.SLASH_ASSIGN, p.parseAssignExpression)
 
 	p.advance()
 	p.advance()
@@ -55,7 +87,11 @@ type Parser struct {
 	lexer     *lexer.Lexer
 	curToken  token.Token
 	nextToken token.Token
-	errors    []string
+	errors    []*diagnostic.Diagnostic
+	panicking bool // Set after a syntax error until the parser resynchronizes.
+	blocks    int  // Depth of the block statements being parsed.
+	loops     int  // Depth of the loop bodies being parsed, within the current function.
+	tails     bool // Set when a returned call can replace the current function call.
 	prefixFns map[token.Type]prefixFn
 	infixFns  map[token.Type]infixFn
 }
@@ -66,24 +102,36 @@ func (p *Parser) Parse() *ast.Program {
 	prg.Statements = []ast.Statement{}
 
 	for !p.curToken.IsType(token.EOF) {
+		start := p.curToken
 		stmt := p.parseStatement()
 		if stmt != nil {
 			prg.Statements = append(prg.Statements, stmt)
 		}
-		p.advance()
+		p.next(start)
 	}
 	return prg
 }
 
-func (p *Parser) addError(format string, a ...interface{}) {
-	p.errors = append(p.errors, fmt.Sprintf(format, a...))
+// addError records a syntax error. Only the first error is recorded until the
+// parser has resynchronized, as anything after it is likely to be a cascade.
+func (p *Parser) addError(code diagnostic.Code, tok token.Token, format string, a ...interface{}) {
+	if p.panicking {
+		return
+	}
+	p.panicking = true
+	p.errors = append(p.errors, diagnostic.New(code, tok.Span(), format, a...))
 }
 
 // Errors return all parsing errors.
-func (p *Parser) Errors() []string {
+func (p *Parser) Errors() []*diagnostic.Diagnostic {
 	return p.errors
 }
 
+// The lexer reports its errors as illegal tokens carrying the message.
+func (p *Parser) addIllegalError(tok token.Token) {
+	p.addError(diagnostic.IllegalToken, tok, "%s", tok.Literal)
+}
+
 func (p *Parser) registerPrefixFn(t token.Type, fn prefixFn) {
 	p.prefixFns[t] = fn
 }
@@ -94,7 +142,64 @@ func (p *Parser) registerInfixFn(t token.Type, fn infixFn) {
 
 func (p *Parser) advance() {
 	p.curToken = p.nextToken
-	p.nextToken, _ = <-p.lexer.Tokens
+	p.nextToken = p.lexer.NextToken()
+
+	// Comments are only of interest to tooling.
+	for p.nextToken.IsType(token.COMMENT) {
+		p.nextToken = p.lexer.NextToken()
+	}
+}
+
+// next moves on to the first token of the statement following the one which
+// began with start.
+func (p *Parser) next(start token.Token) {
+	if p.panicking {
+		p.synchronize(start)
+	} else {
+		p.advance()
+	}
+}
+
+// synchronize skips the rest of a statement containing a syntax error. It
+// stops at the first token of the next statement, either following a
+// semicolon or at a statement keyword, or at the brace closing the block
+// being parsed. A stray closing brace outside of any block is skipped.
+func (p *Parser) synchronize(start token.Token) {
+	p.panicking = false
+	depth := 0
+
+	for !p.curToken.IsType(token.EOF) {
+		switch p.curToken.Type {
+		case token.BREAK, token.CONST, token.CONTINUE, token.FOR, token.LET, token.RETURN, token.THROW, token.WHILE:
+			if depth == 0 && p.curToken.Pos != start.Pos {
+				return
+			}
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			if depth == 0 {
+				if p.blocks > 0 {
+					return
+				}
+				break
+			}
+			depth--
+		case token.SEMICOLON:
+			if depth == 0 {
+				p.advance()
+				return
+			}
+		}
+		p.advance()
+	}
+}
+
+func (p *Parser) badExpression(from token.Position) *ast.BadExpression {
+	return &ast.BadExpression{Token: p.curToken, From: from, To: p.curToken.End}
+}
+
+func (p *Parser) badStatement(from token.Position) *ast.BadStatement {
+	return &ast.BadStatement{Token: p.curToken, From: from, To: p.curToken.End}
 }
 
 func (p *Parser) expect(t token.Type) bool {
@@ -102,28 +207,86 @@ func (p *Parser) expect(t token.Type) bool {
 		p.advance()
 		return true
 	}
-	p.addError("Expected token '%s', got '%s' instead", t, p.nextToken.Type)
+	if p.nextToken.IsType(token.ILLEGAL) {
+		p.addIllegalError(p.nextToken)
+		return false
+	}
+	p.addError(diagnostic.UnexpectedToken, p.nextToken, "Expected token '%s', got '%s' instead", t, p.nextToken.Type)
 	return false
 }
 
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
+	case token.BREAK:
+		return p.parseBreakStatement()
+	case token.CONST:
+		return p.parseConstStatement()
+	case token.CONTINUE:
+		return p.parseContinueStatement()
+	case token.FOR:
+		return p.parseForStatement()
 	case token.LET:
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
-func (p *Parser) parseLetStatement() *ast.LetStatement {
+func (p *Parser) parseLetStatement() ast.Statement {
 	stmt := &ast.LetStatement{
 		Token: p.curToken,
 	}
 
+	// Arrays and hashes are destructured into the names in the pattern.
+	if p.nextToken.IsType(token.LBRACKET) || p.nextToken.IsType(token.LBRACE) {
+		p.advance()
+		stmt.Pattern = p.parsePattern()
+		if stmt.Pattern == nil {
+			return p.badStatement(stmt.Token.Pos)
+		}
+	} else {
+		if !p.expect(token.IDENT) {
+			return p.badStatement(stmt.Token.Pos)
+		}
+
+		stmt.Name = &ast.Identifier{
+			Token: p.curToken,
+			Value: p.curToken.Literal,
+		}
+	}
+
+	if !p.expect(token.ASSIGN) {
+		return p.badStatement(stmt.Token.Pos)
+	}
+
+	p.advance()
+
+	stmt.Value = p.parseExpression(precedence.LOWEST)
+
+	if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok && stmt.Name != nil {
+		fn.Name = stmt.Name.Value
+	}
+
+	if p.nextToken.IsType(token.SEMICOLON) {
+		p.advance()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseConstStatement() ast.Statement {
+	stmt := &ast.ConstStatement{
+		Token: p.curToken,
+	}
+
 	if !p.expect(token.IDENT) {
-		return nil
+		return p.badStatement(stmt.Token.Pos)
 	}
 
 	stmt.Name = &ast.Identifier{
@@ -131,14 +294,21 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 		Value: p.curToken.Literal,
 	}
 
-	if !p.expect(token.ASSIGN) {
-		return nil
+	// A constant can never be given a value later.
+	if !p.nextToken.IsType(token.ASSIGN) {
+		p.addError(diagnostic.MissingInitializer, p.curToken, "missing initializer for constant '%s'", stmt.Name.Value)
+		return p.badStatement(stmt.Token.Pos)
 	}
 
+	p.advance()
 	p.advance()
 
 	stmt.Value = p.parseExpression(precedence.LOWEST)
 
+	if fn, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		fn.Name = stmt.Name.Value
+	}
+
 	if p.nextToken.IsType(token.SEMICOLON) {
 		p.advance()
 	}
@@ -153,6 +323,201 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 	stmt.Value = p.parseExpression(precedence.LOWEST)
 
+	if _, ok := stmt.Value.(*ast.CallExpression); ok {
+		stmt.Tail = p.tails
+	}
+
+	if p.nextToken.IsType(token.SEMICOLON) {
+		p.advance()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.advance()
+
+	stmt.Value = p.parseExpression(precedence.LOWEST)
+
+	if p.nextToken.IsType(token.SEMICOLON) {
+		p.advance()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{
+		Token: p.curToken,
+	}
+
+	if !p.expect(token.LPAREN) {
+		return p.badStatement(stmt.Token.Pos)
+	}
+
+	p.advance()
+	stmt.Condition = p.parseExpression(precedence.LOWEST)
+
+	if !p.expect(token.RPAREN) {
+		return p.badStatement(stmt.Token.Pos)
+	}
+
+	if !p.expect(token.LBRACE) {
+		return p.badStatement(stmt.Token.Pos)
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.nextToken.IsType(token.SEMICOLON) {
+		p.advance()
+	}
+
+	return stmt
+}
+
+// parseForStatement parses both kinds of for loop, a for-in loop being
+// recognised by the 'in' following the variable name.
+func (p *Parser) parseForStatement() ast.Statement {
+	tok := p.curToken
+
+	if !p.expect(token.LPAREN) {
+		return p.badStatement(tok.Pos)
+	}
+
+	p.advance()
+
+	if p.curToken.IsType(token.IDENT) && p.nextToken.IsType(token.IN) {
+		return p.parseForInStatement(tok)
+	}
+
+	stmt := &ast.ForStatement{
+		Token: tok,
+	}
+
+	if !p.curToken.IsType(token.SEMICOLON) {
+		stmt.Init = p.parseStatement()
+		if p.panicking {
+			return p.badForStatement(tok)
+		}
+		if !p.curToken.IsType(token.SEMICOLON) && !p.expect(token.SEMICOLON) {
+			return p.badForStatement(tok)
+		}
+	}
+
+	p.advance()
+
+	if !p.curToken.IsType(token.SEMICOLON) {
+		stmt.Condition = p.parseExpression(precedence.LOWEST)
+		if !p.expect(token.SEMICOLON) {
+			return p.badForStatement(tok)
+		}
+	}
+
+	p.advance()
+
+	if !p.curToken.IsType(token.RPAREN) {
+		stmt.Update = p.parseExpression(precedence.LOWEST)
+		if !p.expect(token.RPAREN) {
+			return p.badForStatement(tok)
+		}
+	}
+
+	if !p.expect(token.LBRACE) {
+		return p.badStatement(tok.Pos)
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.nextToken.IsType(token.SEMICOLON) {
+		p.advance()
+	}
+
+	return stmt
+}
+
+// badForStatement skips to the end of a for loop header containing a syntax
+// error, so the semicolons within it aren't mistaken for statement boundaries.
+func (p *Parser) badForStatement(tok token.Token) ast.Statement {
+	depth := 0
+
+	for !p.curToken.IsType(token.EOF) && !p.curToken.IsType(token.LBRACE) {
+		if p.curToken.IsType(token.LPAREN) {
+			depth++
+		} else if p.curToken.IsType(token.RPAREN) {
+			if depth == 0 {
+				break
+			}
+			depth--
+		}
+		p.advance()
+	}
+
+	return p.badStatement(tok.Pos)
+}
+
+func (p *Parser) parseForInStatement(tok token.Token) ast.Statement {
+	stmt := &ast.ForInStatement{
+		Token: tok,
+		Name: &ast.Identifier{
+			Token: p.curToken,
+			Value: p.curToken.Literal,
+		},
+	}
+
+	p.advance()
+	p.advance()
+	stmt.Iterable = p.parseExpression(precedence.LOWEST)
+
+	if !p.expect(token.RPAREN) {
+		return p.badStatement(tok.Pos)
+	}
+
+	if !p.expect(token.LBRACE) {
+		return p.badStatement(tok.Pos)
+	}
+
+	stmt.Body = p.parseLoopBody()
+
+	if p.nextToken.IsType(token.SEMICOLON) {
+		p.advance()
+	}
+
+	return stmt
+}
+
+// parseLoopBody parses the block statement of a loop.
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loops++
+	defer func() { p.loops-- }()
+
+	return p.parseBlockStatement()
+}
+
+func (p *Parser) parseBreakStatement() ast.Statement {
+	stmt := &ast.BreakStatement{Token: p.curToken}
+
+	if p.loops == 0 {
+		p.addError(diagnostic.MisplacedStatement, p.curToken, "break outside loop")
+		return p.badStatement(stmt.Token.Pos)
+	}
+
+	if p.nextToken.IsType(token.SEMICOLON) {
+		p.advance()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseContinueStatement() ast.Statement {
+	stmt := &ast.ContinueStatement{Token: p.curToken}
+
+	if p.loops == 0 {
+		p.addError(diagnostic.MisplacedStatement, p.curToken, "continue outside loop")
+		return p.badStatement(stmt.Token.Pos)
+	}
+
 	if p.nextToken.IsType(token.SEMICOLON) {
 		p.advance()
 	}
@@ -177,13 +542,22 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 func (p *Parser) parseExpression(prec int) ast.Expression {
 	prefix := p.prefixFns[p.curToken.Type]
 	if prefix == nil {
-		p.addError("no prefix parse function for %s found", p.curToken.Type)
-		return nil
+		if p.curToken.IsType(token.ILLEGAL) {
+			p.addIllegalError(p.curToken)
+		} else {
+			p.addError(diagnostic.ExpectedExpression, p.curToken, "no prefix parse function for %s found", p.curToken.Type)
+		}
+		return p.badExpression(p.curToken.Pos)
 	}
 
 	leftExp := prefix()
 
 	for !p.nextToken.IsType(token.SEMICOLON) && prec < p.nextToken.Precedence() {
+		// Operators following a syntax error are skipped by synchronize.
+		if p.panicking {
+			return leftExp
+		}
+
 		infix := p.infixFns[p.nextToken.Type]
 		if infix == nil {
 			return leftExp
@@ -211,9 +585,32 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 
+	if errors.Is(err, strconv.ErrRange) {
+		if lit.Big, _ = new(big.Int).SetString(p.curToken.Literal, 0); lit.Big != nil {
+			return lit
+		}
+	}
+
 	if err != nil {
-		p.addError("could not parse %q as integer", p.curToken.Literal)
-		return nil
+		p.addError(diagnostic.InvalidInteger, p.curToken, "could not parse %q as integer", p.curToken.Literal)
+		return p.badExpression(p.curToken.Pos)
+	}
+
+	lit.Value = value
+
+	return lit
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	lit := &ast.FloatLiteral{
+		Token: p.curToken,
+	}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+
+	if err != nil {
+		p.addError(diagnostic.InvalidFloat, p.curToken, "could not parse %q as float", p.curToken.Literal)
+		return p.badExpression(p.curToken.Pos)
 	}
 
 	lit.Value = value
@@ -242,12 +639,37 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	prec := p.curToken.Precedence()
+	if p.curToken.IsRightAssociative() {
+		prec--
+	}
 	p.advance()
 	expression.Right = p.parseExpression(prec)
 
 	return expression
 }
 
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Target:   target,
+	}
+
+	switch target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	default:
+		p.addError(diagnostic.InvalidAssignment, p.curToken, "cannot assign to %s", target.String())
+		return p.badExpression(target.Pos())
+	}
+
+	// Assignments are right associative.
+	prec := p.curToken.Precedence() - 1
+	p.advance()
+	expression.Value = p.parseExpression(prec)
+
+	return expression
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{
 		Token: p.curToken,
@@ -256,12 +678,14 @@ func (p *Parser) parseBoolean() ast.Expression {
 }
 
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	lparen := p.curToken
+
 	p.advance()
 
 	exp := p.parseExpression(precedence.LOWEST)
 
 	if !p.expect(token.RPAREN) {
-		return nil
+		return p.badExpression(lparen.Pos)
 	}
 
 	return exp
@@ -273,18 +697,18 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	}
 
 	if !p.expect(token.LPAREN) {
-		return nil
+		return p.badExpression(expression.Token.Pos)
 	}
 
 	p.advance()
 	expression.Condition = p.parseExpression(precedence.LOWEST)
 
 	if !p.expect(token.RPAREN) {
-		return nil
+		return p.badExpression(expression.Token.Pos)
 	}
 
 	if !p.expect(token.LBRACE) {
-		return nil
+		return p.badExpression(expression.Token.Pos)
 	}
 
 	expression.Consequence = p.parseBlockStatement()
@@ -292,8 +716,27 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	if p.nextToken.IsType(token.ELSE) {
 		p.advance()
 
+		// An else if is treated as a block containing the nested if.
+		if p.nextToken.IsType(token.IF) {
+			p.advance()
+			tok := p.curToken
+
+			nested := p.parseIfExpression()
+			if _, ok := nested.(*ast.BadExpression); ok {
+				return p.badExpression(expression.Token.Pos)
+			}
+
+			expression.Alternative = &ast.BlockStatement{
+				Token: tok,
+				Statements: []ast.Statement{
+					&ast.ExpressionStatement{Token: tok, Expression: nested},
+				},
+			}
+			return expression
+		}
+
 		if !p.expect(token.LBRACE) {
-			return nil
+			return p.badExpression(expression.Token.Pos)
 		}
 
 		expression.Alternative = p.parseBlockStatement()
@@ -302,22 +745,353 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+// A try expression needs a catch block, a finally block, or both. The name
+// the caught error is bound to is optional.
+func (p *Parser) parseTryExpression() ast.Expression {
+	expression := &ast.TryExpression{
+		Token: p.curToken,
+	}
+
+	// A call returned from within a try must be made before the catch and
+	// finally blocks, so can't be deferred until the function has returned.
+	tails := p.tails
+	p.tails = false
+	defer func() { p.tails = tails }()
+
+	if !p.expect(token.LBRACE) {
+		return p.badExpression(expression.Token.Pos)
+	}
+
+	expression.Block = p.parseBlockStatement()
+
+	if p.nextToken.IsType(token.CATCH) {
+		p.advance()
+
+		if p.nextToken.IsType(token.LPAREN) {
+			p.advance()
+			if !p.expect(token.IDENT) {
+				return p.badExpression(expression.Token.Pos)
+			}
+			expression.Param = &ast.Identifier{
+				Token: p.curToken,
+				Value: p.curToken.Literal,
+			}
+			if !p.expect(token.RPAREN) {
+				return p.badExpression(expression.Token.Pos)
+			}
+		}
+
+		if !p.expect(token.LBRACE) {
+			return p.badExpression(expression.Token.Pos)
+		}
+
+		expression.Catch = p.parseBlockStatement()
+	}
+
+	if p.nextToken.IsType(token.FINALLY) {
+		p.advance()
+
+		if !p.expect(token.LBRACE) {
+			return p.badExpression(expression.Token.Pos)
+		}
+
+		expression.Finally = p.parseBlockStatement()
+	}
+
+	if expression.Catch == nil && expression.Finally == nil {
+		p.addError(diagnostic.UnexpectedToken, p.nextToken, "Expected token '%s' or '%s', got '%s' instead", token.CATCH, token.FINALLY, p.nextToken.Type)
+		return p.badExpression(expression.Token.Pos)
+	}
+
+	return expression
+}
+
+func (p *Parser) parseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{
+		Token: p.curToken,
+	}
+
+	if !p.expect(token.LPAREN) {
+		return p.badExpression(expression.Token.Pos)
+	}
+
+	p.advance()
+	expression.Subject = p.parseExpression(precedence.LOWEST)
+
+	if !p.expect(token.RPAREN) {
+		return p.badExpression(expression.Token.Pos)
+	}
+
+	if !p.expect(token.LBRACE) {
+		return p.badExpression(expression.Token.Pos)
+	}
+
+	p.advance()
+
+	for !p.curToken.IsType(token.RBRACE) {
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return p.badExpression(expression.Token.Pos)
+		}
+		expression.Arms = append(expression.Arms, arm)
+
+		// Arms are separated by commas, the last one optionally so.
+		if p.nextToken.IsType(token.COMMA) || p.nextToken.IsType(token.SEMICOLON) {
+			p.advance()
+			p.advance()
+		} else if !p.expect(token.RBRACE) {
+			return p.badExpression(expression.Token.Pos)
+		}
+	}
+
+	expression.Rbrace = p.curToken
+
+	return expression
+}
+
+// parseMatchArm parses a single arm of a match expression. Arms take
+// patterns, not arbitrary expressions, so a bare identifier binds a new name
+// rather than comparing against an existing variable. A computed value is
+// compared using a guard, such as 'n if n == x + 1 => ...'.
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{
+		Token: p.curToken,
+	}
+
+	for {
+		pattern := p.parsePattern()
+		if pattern == nil {
+			return nil
+		}
+		// Report an expression such as '1 + 1' as a pattern error, rather than
+		// as a missing arrow after its first operand.
+		if _, ok := p.infixFns[p.nextToken.Type]; ok {
+			p.addError(diagnostic.ExpectedPattern, p.nextToken, "expected pattern, got expression; use a guard to compare against a computed value")
+			return nil
+		}
+		arm.Patterns = append(arm.Patterns, pattern)
+		if !p.nextToken.IsType(token.COMMA) {
+			break
+		}
+		p.advance()
+		p.advance()
+	}
+
+	if p.nextToken.IsType(token.IF) {
+		p.advance()
+		p.advance()
+		arm.Guard = p.parseExpression(precedence.LOWEST)
+		if p.panicking {
+			return nil
+		}
+	}
+
+	if !p.expect(token.ARROW) {
+		return nil
+	}
+
+	p.advance()
+
+	// A brace after the arrow starts a block rather than a hash literal.
+	if p.curToken.IsType(token.LBRACE) {
+		arm.Body = p.parseBlockStatement()
+	} else {
+		arm.Body = &ast.ExpressionStatement{
+			Token:      p.curToken,
+			Expression: p.parseExpression(precedence.LOWEST),
+		}
+	}
+
+	if p.panicking {
+		return nil
+	}
+
+	return arm
+}
+
+// parsePattern parses the pattern starting at the current token, returning nil
+// if it contains a syntax error. Patterns are binding names, literals, and
+// array or hash patterns built from them; they are never evaluated as
+// expressions.
+func (p *Parser) parsePattern() ast.Pattern {
+	switch p.curToken.Type {
+	case token.IDENT:
+		return p.parseBindingPattern()
+	case token.FALSE, token.FLOAT, token.INT, token.MINUS, token.STRING, token.TRUE:
+		return p.parseLiteralPattern()
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	case token.ILLEGAL:
+		p.addIllegalError(p.curToken)
+	default:
+		p.addError(diagnostic.ExpectedPattern, p.curToken, "expected pattern, got '%s'", p.curToken.Type)
+	}
+	return nil
+}
+
+func (p *Parser) parseBindingPattern() ast.Pattern {
+	pattern := &ast.BindingPattern{
+		Name: &ast.Identifier{
+			Token: p.curToken,
+			Value: p.curToken.Literal,
+		},
+	}
+
+	if !p.nextToken.IsType(token.COLON) {
+		return pattern
+	}
+
+	p.advance()
+
+	// Function types are named by their keyword.
+	if p.nextToken.IsType(token.FUNCTION) {
+		p.advance()
+	} else if !p.expect(token.IDENT) {
+		return nil
+	}
+
+	pattern.Type = &ast.Identifier{
+		Token: p.curToken,
+		Value: p.curToken.Literal,
+	}
+
+	return pattern
+}
+
+func (p *Parser) parseLiteralPattern() ast.Pattern {
+	var value ast.Expression
+
+	if p.curToken.IsType(token.MINUS) {
+		// Only negative numbers are literals, not arbitrary negations.
+		if !p.nextToken.IsType(token.INT) && !p.nextToken.IsType(token.FLOAT) {
+			p.addError(diagnostic.ExpectedPattern, p.nextToken, "expected number, got '%s'", p.nextToken.Type)
+			return nil
+		}
+		value = p.parsePrefixExpression()
+	} else {
+		value = p.prefixFns[p.curToken.Type]()
+	}
+
+	if p.panicking {
+		return nil
+	}
+
+	return &ast.LiteralPattern{Value: value}
+}
+
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{
+		Token: p.curToken,
+	}
+
+	for !p.nextToken.IsType(token.RBRACKET) {
+		p.advance()
+
+		// The rest of the array can only be collected at its end.
+		if p.curToken.IsType(token.ELLIPSIS) {
+			if !p.expect(token.IDENT) {
+				return nil
+			}
+			pattern.Rest = &ast.Identifier{
+				Token: p.curToken,
+				Value: p.curToken.Literal,
+			}
+			if !p.expect(token.RBRACKET) {
+				return nil
+			}
+			pattern.Rbracket = p.curToken
+			return pattern
+		}
+
+		element := p.parsePattern()
+		if element == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, element)
+
+		if !p.nextToken.IsType(token.RBRACKET) && !p.expect(token.COMMA) {
+			return nil
+		}
+	}
+
+	p.advance()
+	pattern.Rbracket = p.curToken
+
+	return pattern
+}
+
+func (p *Parser) parseHashPattern() ast.Pattern {
+	pattern := &ast.HashPattern{
+		Token: p.curToken,
+	}
+
+	for !p.nextToken.IsType(token.RBRACE) {
+		// Keys are literals, as they are looked up rather than matched.
+		switch p.nextToken.Type {
+		case token.FALSE, token.FLOAT, token.INT, token.MINUS, token.STRING, token.TRUE:
+		default:
+			p.addError(diagnostic.ExpectedPattern, p.nextToken, "expected literal key, got '%s'", p.nextToken.Type)
+			return nil
+		}
+
+		p.advance()
+		literal := p.parseLiteralPattern()
+		if literal == nil {
+			return nil
+		}
+		key := literal.(*ast.LiteralPattern).Value
+
+		if !p.expect(token.COLON) {
+			return nil
+		}
+
+		p.advance()
+		value := p.parsePattern()
+		if value == nil {
+			return nil
+		}
+
+		pattern.Pairs = append(pattern.Pairs, ast.HashPatternPair{Key: key, Value: value})
+
+		if !p.nextToken.IsType(token.RBRACE) && !p.expect(token.COMMA) {
+			return nil
+		}
+	}
+
+	p.advance()
+	pattern.Rbrace = p.curToken
+
+	return pattern
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{
 		Token: p.curToken,
 	}
 	block.Statements = []ast.Statement{}
 
+	p.blocks++
+	defer func() { p.blocks-- }()
+
 	p.advance()
 
 	for !p.curToken.IsType(token.RBRACE) && !p.curToken.IsType(token.EOF) {
+		start := p.curToken
 		stmt := p.parseStatement()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
 		}
-		p.advance()
+		p.next(start)
 	}
 
+	if !p.curToken.IsType(token.RBRACE) {
+		p.addError(diagnostic.UnexpectedToken, p.curToken, "Expected token '%s', got '%s' instead", token.RBRACE, p.curToken.Type)
+	}
+
+	block.Rbrace = p.curToken
+
 	return block
 }
 
@@ -327,59 +1101,145 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	}
 
 	if !p.expect(token.LPAREN) {
-		return nil
+		return p.badExpression(lit.Token.Pos)
 	}
 
 	lit.Parameters = p.parseFunctionParameters()
+	if lit.Parameters == nil {
+		return p.badExpression(lit.Token.Pos)
+	}
 
 	if !p.expect(token.LBRACE) {
-		return nil
+		return p.badExpression(lit.Token.Pos)
 	}
 
+	// Loops outside of the function can't be controlled from inside it.
+	loops, tails := p.loops, p.tails
+	p.loops, p.tails = 0, true
 	lit.Body = p.parseBlockStatement()
+	p.loops, p.tails = loops, tails
 
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+// Parameters with default values must follow those without, and a rest
+// parameter must be the last.
+func (p *Parser) parseFunctionParameters() []*ast.Parameter {
+	parameters := []*ast.Parameter{}
 
 	if p.nextToken.IsType(token.RPAREN) {
 		p.advance()
-		return identifiers
+		return parameters
 	}
 
-	p.advance()
+	for {
+		param := &ast.Parameter{Token: p.nextToken}
 
-	ident := &ast.Identifier{
-		Token: p.curToken,
-		Value: p.curToken.Literal,
-	}
-	identifiers = append(identifiers, ident)
+		if p.nextToken.IsType(token.ELLIPSIS) {
+			p.advance()
+			param.Rest = true
+		}
 
-	for p.nextToken.IsType(token.COMMA) {
-		p.advance()
-		p.advance()
-		ident := &ast.Identifier{
+		if !p.expect(token.IDENT) {
+			return nil
+		}
+
+		param.Name = &ast.Identifier{
 			Token: p.curToken,
 			Value: p.curToken.Literal,
 		}
-		identifiers = append(identifiers, ident)
+
+		if !param.Rest && p.nextToken.IsType(token.ASSIGN) {
+			p.advance()
+			p.advance()
+			param.Default = p.parseExpression(precedence.LOWEST)
+			if p.panicking {
+				return nil
+			}
+		}
+
+		last := len(parameters) - 1
+		if !param.Rest && param.Default == nil && last >= 0 && parameters[last].Default != nil {
+			p.addError(diagnostic.InvalidParameter, param.Token, "parameter '%s' without a default follows one with a default", param.Name.Value)
+			return nil
+		}
+
+		parameters = append(parameters, param)
+
+		if param.Rest || !p.nextToken.IsType(token.COMMA) {
+			break
+		}
+		p.advance()
 	}
 
 	if !p.expect(token.RPAREN) {
 		return nil
 	}
 
-	return identifiers
+	return parameters
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
-	exp.Arguments = p.parseExpressionList(token.RPAREN)
+
+	if !p.parseCallArguments(exp) {
+		return p.badExpression(function.Pos())
+	}
+
+	exp.Rparen = p.curToken
 	return exp
 }
 
+// parseCallArguments parses the arguments of a call into it. Positional
+// arguments can be arrays spread into separate arguments, and must come
+// before any named arguments.
+func (p *Parser) parseCallArguments(exp *ast.CallExpression) bool {
+	exp.Arguments = []ast.Expression{}
+
+	if p.nextToken.IsType(token.RPAREN) {
+		p.advance()
+		return true
+	}
+
+	for {
+		p.advance()
+
+		switch {
+		case p.curToken.IsType(token.IDENT) && p.nextToken.IsType(token.COLON):
+			arg := &ast.NamedArgument{
+				Name: &ast.Identifier{
+					Token: p.curToken,
+					Value: p.curToken.Literal,
+				},
+			}
+			p.advance()
+			p.advance()
+			arg.Value = p.parseExpression(precedence.LOWEST)
+			exp.Named = append(exp.Named, arg)
+
+		case len(exp.Named) > 0:
+			p.addError(diagnostic.InvalidArgument, p.curToken, "positional argument follows named argument")
+			return false
+
+		case p.curToken.IsType(token.ELLIPSIS):
+			spread := &ast.SpreadExpression{Token: p.curToken}
+			p.advance()
+			spread.Value = p.parseExpression(precedence.LOWEST)
+			exp.Arguments = append(exp.Arguments, spread)
+
+		default:
+			exp.Arguments = append(exp.Arguments, p.parseExpression(precedence.LOWEST))
+		}
+
+		if !p.nextToken.IsType(token.COMMA) {
+			break
+		}
+		p.advance()
+	}
+
+	return p.expect(token.RPAREN)
+}
+
 func (p *Parser) parseExpressionList(end token.Type) []ast.Expression {
 	list := []ast.Expression{}
 
@@ -405,9 +1265,15 @@ func (p *Parser) parseExpressionList(end token.Type) []ast.Expression {
 }
 
 func (p *Parser) parseStringLiteral() ast.Expression {
+	value, err := lexer.Unescape(p.curToken.Literal)
+	if err != nil {
+		p.addError(diagnostic.InvalidString, p.curToken, "%s", err)
+		return p.badExpression(p.curToken.Pos)
+	}
+
 	return &ast.StringLiteral{
 		Token: p.curToken,
-		Value: p.curToken.Literal,
+		Value: value,
 	}
 }
 
@@ -417,6 +1283,11 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 	}
 
 	array.Elements = p.parseExpressionList(token.RBRACKET)
+	if array.Elements == nil {
+		return p.badExpression(array.Token.Pos)
+	}
+
+	array.Rbracket = p.curToken
 
 	return array
 }
@@ -431,8 +1302,40 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	exp.Index = p.parseExpression(precedence.LOWEST)
 
 	if !p.expect(token.RBRACKET) {
-		return nil
+		return p.badExpression(exp.Left.Pos())
 	}
 
+	exp.Rbracket = p.curToken
+
 	return exp
 }
+
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{
+		Token: p.curToken,
+	}
+	hash.Pairs = []ast.HashPair{}
+
+	for !p.nextToken.IsType(token.RBRACE) {
+		p.advance()
+		key := p.parseExpression(precedence.LOWEST)
+
+		if !p.expect(token.COLON) {
+			return p.badExpression(hash.Token.Pos)
+		}
+
+		p.advance()
+		value := p.parseExpression(precedence.LOWEST)
+
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+
+		if !p.nextToken.IsType(token.RBRACE) && !p.expect(token.COMMA) {
+			return p.badExpression(hash.Token.Pos)
+		}
+	}
+
+	p.advance()
+	hash.Rbrace = p.curToken
+
+	return hash
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/nomad-software/script/ast"
+	"github.com/nomad-software/script/diagnostic"
 	"github.com/nomad-software/script/lexer"
 )
 
@@ -40,6 +41,109 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestDestructuringLetStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let [a, b] = x;", "let [a, b] = x"},
+		{"let [head, ...tail] = [1, 2, 3]", "let [head, ...tail] = [1, 2, 3]"},
+		{`let {"name": n, "tags": [first, ..._]} = user;`, "let {name: n, tags: [first, ..._]} = user"},
+		{"let [] = x", "let [] = x"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: program.Statements does not contain 1 statements. got=%d", tt.input, len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T", program.Statements[0])
+		}
+
+		if stmt.Pattern == nil || stmt.Name != nil {
+			t.Errorf("%q: expected a pattern rather than a name", tt.input)
+		}
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedIdentifier string
+		expectedValue      interface{}
+	}{
+		{"const x = 5;", "x", 5},
+		{"const y = true;", "y", true},
+		{"const foobar = y", "foobar", "y"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ConstStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ConstStatement. got=%T", program.Statements[0])
+		}
+
+		if stmt.Name.Value != tt.expectedIdentifier {
+			t.Errorf("stmt.Name.Value not '%s'. got=%s", tt.expectedIdentifier, stmt.Name.Value)
+		}
+
+		if !testLiteralExpression(t, stmt.Value, tt.expectedValue) {
+			return
+		}
+	}
+}
+
+func TestConstWithoutInitializer(t *testing.T) {
+	input := "const x;\nconst y = 1;\nconst z\nlet a = 2;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.Parse()
+
+	expected := []string{
+		"1:7: missing initializer for constant 'x'",
+		"3:7: missing initializer for constant 'z'",
+	}
+
+	errors := p.Errors()
+	if len(errors) != len(expected) {
+		t.Fatalf("wrong number of errors. want=%d, got=%d", len(expected), len(errors))
+	}
+
+	for i, err := range errors {
+		if err.Error() != expected[i] {
+			t.Errorf("errors[%d] wrong. want=%q, got=%q", i, expected[i], err.Error())
+		}
+		if err.Code != diagnostic.MissingInitializer {
+			t.Errorf("errors[%d] wrong code. want=%q, got=%q", i, diagnostic.MissingInitializer, err.Code)
+		}
+	}
+
+	if len(program.Statements) != 4 {
+		t.Fatalf("program.Statements does not contain 4 statements. got=%d", len(program.Statements))
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input         string
@@ -74,6 +178,78 @@ func TestReturnStatements(t *testing.T) {
 	}
 }
 
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []bool
+	}{
+		{"return f();", []bool{false}},
+		{"fn() { return f() }", []bool{true}},
+		{"fn() { return f() + 1 }", []bool{false}},
+		{"fn() { return f }", []bool{false}},
+		{"fn() { if (x) { return f(1) } else { return g(2) } }", []bool{true, true}},
+		{"fn() { return fn() { return f() } }", []bool{false, true}},
+		{"fn() { try { return f() } catch (e) { return g() } finally { return h() } }", []bool{false, false, false}},
+		{"fn() { try { 1 } finally { 2 }; return f() }", []bool{true}},
+		{"fn() { try { fn() { return f() } } catch { 0 } }", []bool{true}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		returns := collectReturns(program)
+		if len(returns) != len(tt.expected) {
+			t.Fatalf("%q: wrong number of return statements. want=%d, got=%d", tt.input, len(tt.expected), len(returns))
+		}
+
+		for i, ret := range returns {
+			if ret.Tail != tt.expected[i] {
+				t.Errorf("%q: return %d tail wrong. want=%t, got=%t", tt.input, i, tt.expected[i], ret.Tail)
+			}
+		}
+	}
+}
+
+// collectReturns finds the return statements in the nodes used by
+// TestTailCalls, in source order.
+func collectReturns(node ast.Node) []*ast.ReturnStatement {
+	var returns []*ast.ReturnStatement
+
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, stmt := range node.Statements {
+			returns = append(returns, collectReturns(stmt)...)
+		}
+	case *ast.BlockStatement:
+		for _, stmt := range node.Statements {
+			returns = append(returns, collectReturns(stmt)...)
+		}
+	case *ast.ExpressionStatement:
+		returns = collectReturns(node.Expression)
+	case *ast.ReturnStatement:
+		returns = append([]*ast.ReturnStatement{node}, collectReturns(node.Value)...)
+	case *ast.FunctionLiteral:
+		returns = collectReturns(node.Body)
+	case *ast.IfExpression:
+		returns = collectReturns(node.Consequence)
+		if node.Alternative != nil {
+			returns = append(returns, collectReturns(node.Alternative)...)
+		}
+	case *ast.TryExpression:
+		returns = collectReturns(node.Block)
+		for _, block := range []*ast.BlockStatement{node.Catch, node.Finally} {
+			if block != nil {
+				returns = append(returns, collectReturns(block)...)
+			}
+		}
+	}
+
+	return returns
+}
+
 func TestIdentifierExpression(t *testing.T) {
 	input := "foobar;"
 
@@ -130,6 +306,62 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestBigIntegerLiteralExpression(t *testing.T) {
+	input := "0x1_0000_0000_0000_0000;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.Parse()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program has not enough statements. got=%d", len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.IntegerLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Big == nil || literal.Big.String() != "18446744073709551616" {
+		t.Errorf("literal.Big not %s. got=%s", "18446744073709551616", literal.Big)
+	}
+	if literal.TokenLiteral() != "0x1_0000_0000_0000_0000" {
+		t.Errorf("literal.TokenLiteral not %s. got=%s", "0x1_0000_0000_0000_0000", literal.TokenLiteral())
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{".5;", 0.5},
+		{"1e-9;", 1e-9},
+		{"2E3;", 2000},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+	}
+}
+
 func TestParsingPrefixExpressions(t *testing.T) {
 	prefixTests := []struct {
 		input    string
@@ -142,6 +374,8 @@ func TestParsingPrefixExpressions(t *testing.T) {
 		{"-foobar;", "-", "foobar"},
 		{"!true;", "!", true},
 		{"!false;", "!", false},
+		{"~5;", "~", 5},
+		{"~foobar;", "~", "foobar"},
 	}
 
 	for _, tt := range prefixTests {
@@ -187,6 +421,16 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 ** 5;", 5, "**", 5},
+		{"5 & 5;", 5, "&", 5},
+		{"5 | 5;", 5, "|", 5},
+		{"5 ^ 5;", 5, "^", 5},
+		{"5 &^ 5;", 5, "&^", 5},
+		{"5 << 5;", 5, "<<", 5},
+		{"5 >> 5;", 5, ">>", 5},
 		{"foobar + barfoo;", "foobar", "+", "barfoo"},
 		{"foobar - barfoo;", "foobar", "-", "barfoo"},
 		{"foobar * barfoo;", "foobar", "*", "barfoo"},
@@ -198,6 +442,8 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
+		{"true && false", true, "&&", false},
+		{"false || true", false, "||", true},
 	}
 
 	for _, tt := range infixTests {
@@ -338,6 +584,86 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"a <= b == c >= d",
+			"((a <= b) == (c >= d))",
+		},
+		{
+			"a + b % c",
+			"(a + (b % c))",
+		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a == b && c != d",
+			"((a == b) && (c != d))",
+		},
+		{
+			"2 ** 3 ** 2",
+			"(2 ** (3 ** 2))",
+		},
+		{
+			"a * b ** c",
+			"(a * (b ** c))",
+		},
+		{
+			"-2 ** 2",
+			"(-(2 ** 2))",
+		},
+		{
+			"a | b & c",
+			"(a | (b & c))",
+		},
+		{
+			"a ^ b &^ c",
+			"(a ^ (b &^ c))",
+		},
+		{
+			"a + b << c",
+			"(a + (b << c))",
+		},
+		{
+			"a << b * c >> d",
+			"(((a << b) * c) >> d)",
+		},
+		{
+			"a & b == c",
+			"((a & b) == c)",
+		},
+		{
+			"a | b < c | d",
+			"((a | b) < (c | d))",
+		},
+		{
+			"~a & b",
+			"((~a) & b)",
+		},
+		{
+			"a = b",
+			"(a = b)",
+		},
+		{
+			"a = b = c + d",
+			"(a = (b = (c + d)))",
+		},
+		{
+			"a += b * c",
+			"(a += (b * c))",
+		},
+		{
+			"a[i + 1] -= b || c",
+			"((a[(i + 1)]) -= (b || c))",
+		},
+		{
+			"h[\"k\"] **= 2",
+			"((h[k]) **= 2)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -484,8 +810,8 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
-func TestFunctionLiteralParsing(t *testing.T) {
-	input := `fn(x, y) { x + y; }`
+func TestElseIfExpression(t *testing.T) {
+	input := `if (x < y) { x } else if (x > y) { y } else { z }`
 
 	l := lexer.New(input)
 	p := New(l)
@@ -501,38 +827,55 @@ func TestFunctionLiteralParsing(t *testing.T) {
 		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
 	}
 
-	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	exp, ok := stmt.Expression.(*ast.IfExpression)
 	if !ok {
-		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", stmt.Expression)
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
 	}
 
-	if len(function.Parameters) != 2 {
-		t.Fatalf("function literal parameters wrong. want 2, got=%d\n", len(function.Parameters))
+	if len(exp.Alternative.Statements) != 1 {
+		t.Fatalf("exp.Alternative.Statements does not contain 1 statements. got=%d\n", len(exp.Alternative.Statements))
 	}
 
-	testLiteralExpression(t, function.Parameters[0], "x")
-	testLiteralExpression(t, function.Parameters[1], "y")
-
-	if len(function.Body.Statements) != 1 {
-		t.Fatalf("function.Body.Statements has not 1 statements. got=%d\n", len(function.Body.Statements))
+	alternative, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not ast.ExpressionStatement. got=%T", exp.Alternative.Statements[0])
 	}
 
-	bodyStmt, ok := function.Body.Statements[0].(*ast.ExpressionStatement)
+	nested, ok := alternative.Expression.(*ast.IfExpression)
 	if !ok {
-		t.Fatalf("function body stmt is not ast.ExpressionStatement. got=%T", function.Body.Statements[0])
+		t.Fatalf("alternative is not ast.IfExpression. got=%T", alternative.Expression)
 	}
 
-	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+	if !testInfixExpression(t, nested.Condition, "x", ">", "y") {
+		return
+	}
+
+	if nested.Alternative == nil || len(nested.Alternative.Statements) != 1 {
+		t.Fatalf("nested.Alternative does not contain 1 statements")
+	}
+
+	if exp.End() != nested.End() {
+		t.Errorf("exp.End() wrong. want=%s, got=%s", nested.End(), exp.End())
+	}
 }
 
-func TestFunctionParameterParsing(t *testing.T) {
+func TestMatchExpression(t *testing.T) {
 	tests := []struct {
-		input          string
-		expectedParams []string
+		input    string
+		expected string
 	}{
-		{input: "fn() {};", expectedParams: []string{}},
-		{input: "fn(x) {};", expectedParams: []string{"x"}},
-		{input: "fn(x, y, z) {};", expectedParams: []string{"x", "y", "z"}},
+		{`match (x) { 1, 2 => "low", "x" => y, _ => z }`, `match (x) { 1, 2 => low, x => y, _ => z }`},
+		{`match (x + 1) { 1 => a; 2 => b; }`, `match ((x + 1)) { 1 => a, 2 => b }`},
+		{`match (x) { y => { let a = 1; a }, }`, `match (x) { y => let a = 1a }`},
+		{`match (x) { {"a": 1} => true }`, `match (x) { {a: 1} => true }`},
+		{`match (x) {}`, `match (x) {  }`},
+		{`let r = match (x) { _ => 1 } + 1;`, `let r = (match (x) { _ => 1 } + 1)`},
+		{`match (x) { -1, 2.5, true => a }`, `match (x) { (-1), 2.5, true => a }`},
+		{`match (x) { [first, ...rest] => first, [] => 0 }`, `match (x) { [first, ...rest] => first, [] => 0 }`},
+		{`match (x) { [_, [a, b],] => a }`, `match (x) { [_, [a, b]] => a }`},
+		{`match (x) { {"name": n, "age": a: int} => n }`, `match (x) { {name: n, age: a: int} => n }`},
+		{`match (x) { n: int if n > 0 => n, f: fn => f }`, `match (x) { n: int if (n > 0) => n, f: fn => f }`},
+		{`match (x) { [a, b], {1: a} if a == b || true => a }`, `match (x) { [a, b], {1: a} if ((a == b) || true) => a }`},
 	}
 
 	for _, tt := range tests {
@@ -541,58 +884,465 @@ func TestFunctionParameterParsing(t *testing.T) {
 		program := p.Parse()
 		checkParserErrors(t, p)
 
-		stmt := program.Statements[0].(*ast.ExpressionStatement)
-		function := stmt.Expression.(*ast.FunctionLiteral)
-
-		if len(function.Parameters) != len(tt.expectedParams) {
-			t.Errorf("length parameters wrong. want %d, got=%d\n", len(tt.expectedParams), len(function.Parameters))
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: program.Statements does not contain 1 statements. got=%d", tt.input, len(program.Statements))
 		}
 
-		for i, ident := range tt.expectedParams {
-			testLiteralExpression(t, function.Parameters[i], ident)
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
 		}
 	}
 }
 
-func TestCallExpressionParsing(t *testing.T) {
-	input := "add(1, 2 * 3, 4 + 5);"
+func TestMatchExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"match x { 1 => 2 }", "1:7: Expected token '(', got 'identifier' instead"},
+		{"match (x) { 1 2 }", "1:15: Expected token '=>', got 'int' instead"},
+		{"match (x) { 1 => 2 3 => 4 }", "1:20: Expected token '}', got 'int' instead"},
+		{"match (x) { 1 => 2", "1:19: Expected token '}', got 'end of file' instead"},
+		{"match (x) { 1 + 1 => 2 }", "1:15: expected pattern, got expression; use a guard to compare against a computed value"},
+		{"match (x) { y => 1, f(y) => 2 }", "1:22: expected pattern, got expression; use a guard to compare against a computed value"},
+		{"match (x) { (1) => 2 }", "1:13: expected pattern, got '('"},
+		{"match (x) { -a => 2 }", "1:14: expected number, got 'identifier'"},
+		{"match (x) { [...a, b] => 2 }", "1:18: Expected token ']', got ',' instead"},
+		{"match (x) { {a: 1} => 2 }", "1:14: expected literal key, got 'identifier'"},
+		{"match (x) { a: 1 => 2 }", "1:16: Expected token 'identifier', got 'int' instead"},
+		{"match (x) { a if => 2 }", "1:18: no prefix parse function for => found"},
+		{"let [a, 1 + 2] = x", "1:11: Expected token ',', got '+' instead"},
+	}
 
-	l := lexer.New(input)
-	p := New(l)
-	program := p.Parse()
-	checkParserErrors(t, p)
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.Parse()
 
-	if len(program.Statements) != 1 {
-		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
-	}
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("%q: expected 1 parser error, got %d", tt.input, len(errors))
+		}
 
-	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
-	if !ok {
-		t.Fatalf("stmt is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		if errors[0].Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errors[0].Error())
+		}
 	}
+}
 
-	exp, ok := stmt.Expression.(*ast.CallExpression)
-	if !ok {
-		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+func TestMatchArmExpressionIsNotPattern(t *testing.T) {
+	// Match arms were once arbitrary expressions. They are now patterns, so
+	// an expression arm is reported as such rather than being evaluated.
+	tests := []string{
+		"match (x) { 1 + 1 => \"two\" }",
+		"match (x) { y - 1 => 0 }",
+		"match (x) { a[0] => 0 }",
 	}
 
-	if !testIdentifier(t, exp.Function, "add") {
-		return
-	}
+	for _, input := range tests {
+		l := lexer.New(input)
+		p := New(l)
+		p.Parse()
 
-	if len(exp.Arguments) != 3 {
-		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
-	}
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("%q: expected 1 parser error, got %d", input, len(errors))
+		}
 
-	testLiteralExpression(t, exp.Arguments[0], 1)
-	testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
-	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
+		if errors[0].Code != diagnostic.ExpectedPattern {
+			t.Errorf("%q: wrong error code. want=%q, got=%q", input, diagnostic.ExpectedPattern, errors[0].Code)
+		}
+	}
 }
 
-func TestCallExpressionParameterParsing(t *testing.T) {
+func TestTryExpression(t *testing.T) {
 	tests := []struct {
-		input         string
-		expectedIdent string
+		input    string
+		expected string
+	}{
+		{"try { f() } catch (e) { g(e) }", "try f() catch (e) g(e)"},
+		{"try { f() } catch { 0 }", "try f() catch 0"},
+		{"try { f() } finally { close() }", "try f() finally close()"},
+		{"try { f() } catch (e) { throw e } finally { close() }", "try f() catch (e) throw e finally close()"},
+		{"let x = try { f() } catch (e) { 0 };", "let x = try f() catch (e) 0"},
+		{`throw "boom";`, "throw boom"},
+		{`throw {"message": "m", "kind": "k"}`, "throw {message:m, kind:k}"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: program.Statements does not contain 1 statements. got=%d", tt.input, len(program.Statements))
+		}
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestTryExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"try { f() }", "1:12: Expected token 'catch' or 'finally', got 'end of file' instead"},
+		{"try { f() }; g()", "1:12: Expected token 'catch' or 'finally', got ';' instead"},
+		{"try f() catch { 0 }", "1:5: Expected token '{', got 'identifier' instead"},
+		{"try { f() } catch e { 0 }", "1:19: Expected token '{', got 'identifier' instead"},
+		{"try { f() } catch (1) { 0 }", "1:20: Expected token 'identifier', got 'int' instead"},
+		{"try { f() } finally (e) { 0 }", "1:21: Expected token '{', got '(' instead"},
+		{"throw;", "1:6: no prefix parse function for ; found"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.Parse()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("%q: expected 1 parser error, got %d", tt.input, len(errors))
+		}
+
+		if errors[0].Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errors[0].Error())
+		}
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < y) { x += 1; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.Parse()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.WhileStatement. got=%T", program.Statements[0])
+	}
+
+	if !testInfixExpression(t, stmt.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 1 {
+		t.Errorf("body is not 1 statements. got=%d\n", len(stmt.Body.Statements))
+	}
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"for (let i = 0; i < 10; i += 1) { x }", "for (let i = 0; (i < 10); (i += 1)) x"},
+		{"for (i = 0; i < 10; i += 1) { x }", "for ((i = 0); (i < 10); (i += 1)) x"},
+		{"for (;;) { break }", "for (; ; ) break"},
+		{"for (; i < n;) { continue; }", "for (; (i < n); ) continue"},
+		{"for (x in [1, 2]) { x }", "for (x in [1, 2]) x"},
+		{"for (k in keys(h)) { print(k); };", "for (k in keys(h)) print(k)"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: program.Statements does not contain 1 statements. got=%d", tt.input, len(program.Statements))
+		}
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestLoopErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "1:1: break outside loop"},
+		{"if (x) { continue }", "1:10: continue outside loop"},
+		{"while (x) { fn() { break } }", "1:20: break outside loop"},
+		{"for (let i = 0 i < 1; i += 1) {}", "1:16: Expected token ';', got 'identifier' instead"},
+		{"for (x in y {}", "1:13: Expected token ')', got '{' instead"},
+		{"while x {}", "1:7: Expected token '(', got 'identifier' instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.Parse()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("%q: expected 1 parser error, got %d", tt.input, len(errors))
+		}
+
+		if errors[0].Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errors[0].Error())
+		}
+	}
+}
+
+func TestFunctionLiteralParsing(t *testing.T) {
+	input := `fn(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.Parse()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Body does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	function, ok := stmt.Expression.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(function.Parameters) != 2 {
+		t.Fatalf("function literal parameters wrong. want 2, got=%d\n", len(function.Parameters))
+	}
+
+	testLiteralExpression(t, function.Parameters[0].Name, "x")
+	testLiteralExpression(t, function.Parameters[1].Name, "y")
+
+	if len(function.Body.Statements) != 1 {
+		t.Fatalf("function.Body.Statements has not 1 statements. got=%d\n", len(function.Body.Statements))
+	}
+
+	bodyStmt, ok := function.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("function body stmt is not ast.ExpressionStatement. got=%T", function.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
+func TestFunctionParameterParsing(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedParams []string
+	}{
+		{input: "fn() {};", expectedParams: []string{}},
+		{input: "fn(x) {};", expectedParams: []string{"x"}},
+		{input: "fn(x, y, z) {};", expectedParams: []string{"x", "y", "z"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(function.Parameters) != len(tt.expectedParams) {
+			t.Errorf("length parameters wrong. want %d, got=%d\n", len(tt.expectedParams), len(function.Parameters))
+		}
+
+		for i, ident := range tt.expectedParams {
+			testLiteralExpression(t, function.Parameters[i].Name, ident)
+		}
+	}
+}
+
+func TestDefaultAndRestParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(a, b = 10) { a + b }", "fn(a, b = 10) (a + b)"},
+		{"fn(a = 1, b = a * 2) {}", "fn(a = 1, b = (a * 2)) "},
+		{"fn(head, ...tail) { tail }", "fn(head, ...tail) tail"},
+		{"fn(a, b = 1, ...rest) {}", "fn(a, b = 1, ...rest) "},
+		{"fn(...args) {}", "fn(...args) "},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestParameterErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(a = 1, b) {}", "1:11: parameter 'b' without a default follows one with a default"},
+		{"fn(...a, b) {}", "1:8: Expected token ')', got ',' instead"},
+		{"fn(...a = []) {}", "1:9: Expected token ')', got '=' instead"},
+		{"fn(a = ) {}", "1:8: no prefix parse function for ) found"},
+		{"fn(1) {}", "1:4: Expected token 'identifier', got 'int' instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.Parse()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("%q: expected 1 parser error, got %d", tt.input, len(errors))
+		}
+
+		if errors[0].Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errors[0].Error())
+		}
+	}
+}
+
+func TestNamedArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"f(x, retries: 3, verbose: true)", "f(x, retries: 3, verbose: true)"},
+		{"f(a: 1 + 2)", "f(a: (1 + 2))"},
+		{"f(...xs, a: {1: 2})", "f(...xs, a: {1:2})"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"f(a: 1, 2)", "1:9: positional argument follows named argument"},
+		{"f(a: 1, ...xs)", "1:9: positional argument follows named argument"},
+		{"f(a: )", "1:6: no prefix parse function for ) found"},
+	}
+
+	for _, tt := range errors {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.Parse()
+
+		errs := p.Errors()
+		if len(errs) != 1 {
+			t.Fatalf("%q: expected 1 parser error, got %d", tt.input, len(errs))
+		}
+
+		if errs[0].Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errs[0].Error())
+		}
+	}
+}
+
+func TestFunctionLiteralWithName(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let myFunction = fn() { };", "myFunction"},
+		{"const other = fn(x) { x };", "other"},
+		{"fn() { };", ""},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		var value ast.Expression
+		switch stmt := program.Statements[0].(type) {
+		case *ast.LetStatement:
+			value = stmt.Value
+		case *ast.ConstStatement:
+			value = stmt.Value
+		case *ast.ExpressionStatement:
+			value = stmt.Expression
+		}
+
+		function, ok := value.(*ast.FunctionLiteral)
+		if !ok {
+			t.Fatalf("value is not ast.FunctionLiteral. got=%T", value)
+		}
+
+		if function.Name != tt.expected {
+			t.Errorf("function literal name wrong. want=%q, got=%q", tt.expected, function.Name)
+		}
+	}
+}
+
+func TestCallExpressionParsing(t *testing.T) {
+	input := "add(1, 2 * 3, 4 + 5);"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.Parse()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("stmt is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	exp, ok := stmt.Expression.(*ast.CallExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.CallExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, exp.Function, "add") {
+		return
+	}
+
+	if len(exp.Arguments) != 3 {
+		t.Fatalf("wrong length of arguments. got=%d", len(exp.Arguments))
+	}
+
+	testLiteralExpression(t, exp.Arguments[0], 1)
+	testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
+	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
+}
+
+func TestCallExpressionParameterParsing(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedIdent string
 		expectedArgs  []string
 	}{
 		{
@@ -610,6 +1360,16 @@ func TestCallExpressionParameterParsing(t *testing.T) {
 			expectedIdent: "add",
 			expectedArgs:  []string{"1", "(2 * 3)", "(4 + 5)"},
 		},
+		{
+			input:         "add(1, ...rest, ...[2, 3]);",
+			expectedIdent: "add",
+			expectedArgs:  []string{"1", "...rest", "...[2, 3]"},
+		},
+		{
+			input:         "add(1, retries: 3, verbose: true);",
+			expectedIdent: "add",
+			expectedArgs:  []string{"1"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -659,6 +1419,50 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestStringLiteralEscapes(t *testing.T) {
+	input := `"tab\t\"quote\" \u{263A}";`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.Parse()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+	}
+
+	if literal.Value != "tab\t\"quote\" \u263A" {
+		t.Errorf("literal.Value wrong. got=%q", literal.Value)
+	}
+
+	if literal.TokenLiteral() != `tab\t\"quote\" \u{263A}` {
+		t.Errorf("literal.TokenLiteral wrong. got=%q", literal.TokenLiteral())
+	}
+}
+
+func TestUnterminatedString(t *testing.T) {
+	input := "let a = 1;\nlet b = \"oops;\n"
+
+	l := lexer.New(input)
+	p := New(l)
+	p.Parse()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("wrong number of errors. want=1, got=%d", len(errors))
+	}
+
+	if errors[0].Code != diagnostic.IllegalToken {
+		t.Errorf("wrong error code. want=%q, got=%q", diagnostic.IllegalToken, errors[0].Code)
+	}
+
+	if errors[0].Span.Start.String() != "2:9" {
+		t.Errorf("wrong error position. want=%q, got=%q", "2:9", errors[0].Span.Start)
+	}
+}
+
 func TestParsingArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -704,3 +1508,368 @@ func TestParsingIndexExpressions(t *testing.T) {
 		return
 	}
 }
+
+func TestNodePositions(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedStart string
+		expectedEnd   string
+	}{
+		{"foobar;", "1:1", "1:7"},
+		{"  5 + 10;", "1:3", "1:9"},
+		{"-a * b", "1:1", "1:7"},
+		{"add(1,\n  2)", "1:1", "2:5"},
+		{"[1, 2][0]", "1:1", "1:10"},
+		{"if (x) { 1 } else {\n 2\n}", "1:1", "3:2"},
+		{"fn(x) { x }", "1:1", "1:12"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+
+		if stmt.Expression.Pos().String() != tt.expectedStart {
+			t.Errorf("%q start position wrong. want=%s, got=%s", tt.input, tt.expectedStart, stmt.Expression.Pos())
+		}
+
+		if stmt.Expression.End().String() != tt.expectedEnd {
+			t.Errorf("%q end position wrong. want=%s, got=%s", tt.input, tt.expectedEnd, stmt.Expression.End())
+		}
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		target   string
+		operator string
+		value    interface{}
+	}{
+		{"x = 5;", "x", "=", 5},
+		{"x += y;", "x", "+=", "y"},
+		{"x <<= 2;", "x", "<<=", 2},
+		{"x &^= mask;", "x", "&^=", "mask"},
+		{"a[0] = true;", "(a[0])", "=", true},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain %d statements. got=%d\n", 1, len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+
+		exp, ok := stmt.Expression.(*ast.AssignExpression)
+		if !ok {
+			t.Fatalf("exp is not ast.AssignExpression. got=%T", stmt.Expression)
+		}
+
+		if exp.Target.String() != tt.target {
+			t.Errorf("exp.Target is not %q. got=%q", tt.target, exp.Target.String())
+		}
+
+		if exp.Operator != tt.operator {
+			t.Errorf("exp.Operator is not %q. got=%q", tt.operator, exp.Operator)
+		}
+
+		if !testLiteralExpression(t, exp.Value, tt.value) {
+			return
+		}
+	}
+}
+
+func TestInvalidAssignmentTargets(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"5 = x;", "1:3: cannot assign to 5"},
+		{"a + b = c;", "1:7: cannot assign to (a + b)"},
+		{"f() += 1;", "1:5: cannot assign to f()"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.Parse()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("%q: expected 1 parser error, got %d", tt.input, len(errors))
+		}
+
+		if errors[0].Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, errors[0].Error())
+		}
+
+		if errors[0].Code != diagnostic.InvalidAssignment {
+			t.Errorf("wrong error code. want=%q, got=%q", diagnostic.InvalidAssignment, errors[0].Code)
+		}
+	}
+}
+
+func TestParserErrorPositions(t *testing.T) {
+	input := "let x = 5;\nlet = 10;"
+
+	l := lexer.New(input)
+	p := New(l)
+	p.Parse()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+
+	expected := "2:5: Expected token 'identifier', got '=' instead"
+	if errors[0].Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%q", expected, errors[0].Error())
+	}
+
+	if errors[0].Code != diagnostic.UnexpectedToken {
+		t.Errorf("wrong error code. want=%q, got=%q", diagnostic.UnexpectedToken, errors[0].Code)
+	}
+}
+
+func TestIllegalTokenDiagnostic(t *testing.T) {
+	input := "let x = #;"
+
+	l := lexer.New(input)
+	p := New(l)
+	p.Parse()
+
+	errors := p.Errors()
+	if len(errors) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+
+	if errors[0].Code != diagnostic.IllegalToken {
+		t.Errorf("wrong error code. want=%q, got=%q", diagnostic.IllegalToken, errors[0].Code)
+	}
+
+	if errors[0].Span.Start.String() != "1:9" {
+		t.Errorf("wrong error position. want=%q, got=%q", "1:9", errors[0].Span.Start)
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedErrors []string
+		expectedStmts  int
+	}{
+		{
+			"let = 1;\nlet y = 2 +;\nif (y { y }\nlet z = 3;",
+			[]string{
+				"1:5: Expected token 'identifier', got '=' instead",
+				"2:12: no prefix parse function for ; found",
+				"3:7: Expected token ')', got '{' instead",
+			},
+			4,
+		},
+		{
+			"let f = fn(x) {\n  let = x;\n  x + 1\n};\nf(1 2);\nlet g = 1;",
+			[]string{
+				"2:7: Expected token 'identifier', got '=' instead",
+				"5:5: Expected token ')', got 'int' instead",
+			},
+			3,
+		},
+		{
+			"let a = [1, 2;\nreturn a",
+			[]string{
+				"1:14: Expected token ']', got ';' instead",
+			},
+			2,
+		},
+		{
+			"fn(1) { 2 }\n}\nlet b = 3",
+			[]string{
+				"1:4: Expected token 'identifier', got 'int' instead",
+			},
+			2,
+		},
+		{
+			"if (true) { 1",
+			[]string{
+				"1:14: Expected token '}', got 'end of file' instead",
+			},
+			1,
+		},
+		{
+			`let h = {"a" 1};`,
+			[]string{
+				"1:14: Expected token ':', got 'int' instead",
+			},
+			1,
+		},
+		{
+			"let x = match (1) { 1 => 2 3 => 4 };",
+			[]string{
+				"1:28: Expected token '}', got 'int' instead",
+			},
+			1,
+		},
+		{
+			"print(fn(a) { a + }(1));",
+			[]string{
+				"1:19: no prefix parse function for } found",
+			},
+			1,
+		},
+		{
+			`match (3) { 1 + 2 => "x" }`,
+			[]string{
+				"1:15: expected pattern, got expression; use a guard to compare against a computed value",
+			},
+			1,
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.Parse()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expectedErrors) {
+			for _, e := range errors {
+				t.Errorf("parser error: %q", e.Error())
+			}
+			t.Fatalf("%q wrong number of errors. want=%d, got=%d", tt.input, len(tt.expectedErrors), len(errors))
+		}
+
+		for i, e := range tt.expectedErrors {
+			if errors[i].Error() != e {
+				t.Errorf("%q wrong error. want=%q, got=%q", tt.input, e, errors[i].Error())
+			}
+		}
+
+		if len(program.Statements) != tt.expectedStmts {
+			t.Errorf("%q wrong number of statements. want=%d, got=%d", tt.input, tt.expectedStmts, len(program.Statements))
+		}
+	}
+}
+
+func TestErrorRecoveryPartialNodes(t *testing.T) {
+	input := "let x = 1 +;\nlet = 2;\nlet y = 3;"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.Parse()
+
+	if len(program.Statements) != 3 {
+		t.Fatalf("program.Statements does not contain 3 statements. got=%d", len(program.Statements))
+	}
+
+	let, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.LetStatement. got=%T", program.Statements[0])
+	}
+
+	infix, ok := let.Value.(*ast.InfixExpression)
+	if !ok {
+		t.Fatalf("let.Value is not *ast.InfixExpression. got=%T", let.Value)
+	}
+
+	if _, ok := infix.Right.(*ast.BadExpression); !ok {
+		t.Errorf("infix.Right is not *ast.BadExpression. got=%T", infix.Right)
+	}
+
+	if _, ok := program.Statements[1].(*ast.BadStatement); !ok {
+		t.Errorf("program.Statements[1] is not *ast.BadStatement. got=%T", program.Statements[1])
+	}
+
+	if !testLetStatement(t, program.Statements[2], "y") {
+		return
+	}
+}
+
+func TestParsingHashLiterals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected map[string]string
+	}{
+		{`{}`, map[string]string{}},
+		{`{"one": 1, "two": 2, "three": 3}`, map[string]string{"one": "1", "two": "2", "three": "3"}},
+		{`{"one": 0 + 1, "two": 10 - 8,}`, map[string]string{"one": "(0 + 1)", "two": "(10 - 8)"}},
+		{`{1: true, false: "no"}`, map[string]string{"1": "true", "false": "no"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.Parse()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		hash, ok := stmt.Expression.(*ast.HashLiteral)
+		if !ok {
+			t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+		}
+
+		if len(hash.Pairs) != len(tt.expected) {
+			t.Fatalf("hash.Pairs has wrong length. want=%d, got=%d", len(tt.expected), len(hash.Pairs))
+		}
+
+		for _, pair := range hash.Pairs {
+			expected, ok := tt.expected[pair.Key.String()]
+			if !ok {
+				t.Errorf("unexpected key %q", pair.Key.String())
+				continue
+			}
+			if pair.Value.String() != expected {
+				t.Errorf("wrong value for key %q. want=%q, got=%q", pair.Key.String(), expected, pair.Value.String())
+			}
+		}
+	}
+}
+
+func TestParsingHashLiteralErrors(t *testing.T) {
+	input := `{"one" 1}`
+
+	l := lexer.New(input)
+	p := New(l)
+	p.Parse()
+
+	errors := p.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("wrong number of errors. want=1, got=%d", len(errors))
+	}
+
+	expected := "1:8: Expected token ':', got 'int' instead"
+	if errors[0].Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%q", expected, errors[0].Error())
+	}
+}
+
+func TestParsingWithComments(t *testing.T) {
+	input := "// leading\nlet x = 1 /* inline */ + 2; // trailing\n"
+
+	l := lexer.NewFile("", input, lexer.ScanComments)
+	p := New(l)
+	program := p.Parse()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+
+	if !testLetStatement(t, program.Statements[0], "x") {
+		return
+	}
+
+	val := program.Statements[0].(*ast.LetStatement).Value
+	testInfixExpression(t, val, 1, "+", 2)
+}
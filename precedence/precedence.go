@@ -2,11 +2,15 @@ package precedence
 
 const (
 	LOWEST = iota
+	ASSIGN
+	OR
+	AND
 	EQUALS
 	LESSGREATER
 	SUM
 	PRODUCT
 	PREFIX
+	POWER
 	CALL
 	INDEX
 )
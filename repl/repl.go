@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/nomad-software/script/diagnostic"
 	"github.com/nomad-software/script/evaluator"
 	"github.com/nomad-software/script/lexer"
 	"github.com/nomad-software/script/object"
@@ -31,13 +32,17 @@ func Start(in io.Reader, out io.Writer) {
 		program := p.Parse()
 
 		if len(p.Errors()) != 0 {
-			for _, msg := range p.Errors() {
-				io.WriteString(out, "\t"+msg+"\n")
-			}
+			diagnostic.Render(out, line, p.Errors()...)
 			continue
 		}
 
 		evaluated := evaluator.Eval(program, env)
+		if err, ok := evaluated.(*object.Error); ok {
+			diagnostic.Render(out, line, err.Diagnostic())
+			io.WriteString(out, err.StackTrace())
+			continue
+		}
+
 		if evaluated != nil {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
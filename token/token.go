@@ -9,46 +9,100 @@ import (
 // Type represents the type of a token.
 type Type string
 
+// String returns the name of a token type as shown in diagnostics.
+func (t Type) String() string {
+	if t == EOF {
+		return "end of file"
+	}
+	return string(t)
+}
+
 // Keywords
 const (
+	BREAK    = "break"
+	CATCH    = "catch"
+	CONST    = "const"
+	CONTINUE = "continue"
 	ELSE     = "else"
 	FALSE    = "false"
+	FINALLY  = "finally"
+	FOR      = "for"
 	FUNCTION = "fn"
 	IF       = "if"
+	IN       = "in"
 	LET      = "let"
+	MATCH    = "match"
 	RETURN   = "return"
+	THROW    = "throw"
 	TRUE     = "true"
+	TRY      = "try"
+	WHILE    = "while"
 )
 
 // Operators
 const (
-	ASSIGN    = "="
-	ASTERISK  = "*"
-	BANG      = "!"
-	COMMA     = ","
-	EQUAL     = "=="
-	GT        = ">"
-	LBRACE    = "{"
-	LPAREN    = "("
-	LT        = "<"
-	MINUS     = "-"
-	NOT_EQUAL = "!="
-	PLUS      = "+"
-	RBRACE    = "}"
-	RPAREN    = ")"
-	SLASH     = "/"
-	LBRACKET  = "["
-	RBRACKET  = "]"
+	AMPERSAND   = "&"
+	AND         = "&&"
+	AND_NOT     = "&^"
+	ARROW       = "=>"
+	ASSIGN      = "="
+	ASTERISK    = "*"
+	BANG        = "!"
+	CARET       = "^"
+	COLON       = ":"
+	COMMA       = ","
+	DOT         = "."
+	ELLIPSIS    = "..."
+	EQUAL       = "=="
+	GT          = ">"
+	GT_EQUAL    = ">="
+	LBRACE      = "{"
+	LPAREN      = "("
+	LT          = "<"
+	LT_EQUAL    = "<="
+	MINUS       = "-"
+	NOT_EQUAL   = "!="
+	OR          = "||"
+	PERCENT     = "%"
+	PIPE        = "|"
+	PLUS        = "+"
+	POWER       = "**"
+	RBRACE      = "}"
+	RPAREN      = ")"
+	SHIFT_LEFT  = "<<"
+	SHIFT_RIGHT = ">>"
+	SLASH       = "/"
+	TILDE       = "~"
+	LBRACKET    = "["
+	RBRACKET    = "]"
+)
+
+// Assignment operators
+const (
+	AMPERSAND_ASSIGN   = "&="
+	AND_NOT_ASSIGN     = "&^="
+	ASTERISK_ASSIGN    = "*="
+	CARET_ASSIGN       = "^="
+	MINUS_ASSIGN       = "-="
+	PERCENT_ASSIGN     = "%="
+	PIPE_ASSIGN        = "|="
+	PLUS_ASSIGN        = "+="
+	POWER_ASSIGN       = "**="
+	SHIFT_LEFT_ASSIGN  = "<<="
+	SHIFT_RIGHT_ASSIGN = ">>="
+	SLASH_ASSIGN       = "/="
 )
 
 // Data types
 const (
+	FLOAT  = "float"
 	INT    = "int"
 	STRING = "string"
 )
 
 // Miscellaneous
 const (
+	COMMENT      = "comment"
 	DOUBLE_QUOTE = "\""
 	EOF          = "\uFFFF"
 	IDENT        = "identifier"
@@ -56,10 +110,56 @@ const (
 	SEMICOLON    = ";"
 )
 
+// Position represents a location in the source input.
+type Position struct {
+	File   string // The file name, if any.
+	Offset int    // Byte offset, starting at 0.
+	Line   int    // Line number, starting at 1.
+	Column int    // Column number (in runes), starting at 1.
+}
+
+// IsValid checks if this position has been set.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String returns a string representation of a position.
+func (p Position) String() string {
+	s := p.File
+	if p.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
+}
+
+// Span represents a range of the source input.
+type Span struct {
+	Start Position // Position of the first character.
+	End   Position // Position immediately after the last character.
+}
+
+// String returns a string representation of a span.
+func (s Span) String() string {
+	return s.Start.String()
+}
+
 // Token represents a unit of output from the lexer.
 type Token struct {
 	Type    Type
 	Literal string
+	Pos     Position // Position of the first character of the token.
+	End     Position // Position immediately after the token.
+}
+
+// Span returns the range of the source input covered by the token.
+func (t Token) Span() Span {
+	return Span{Start: t.Pos, End: t.End}
 }
 
 // IsType checks if this token is of a particular type.
@@ -73,13 +173,24 @@ func (t Token) String() string {
 }
 
 var keywords = map[string]Type{
+	BREAK:    BREAK,
+	CONST:    CONST,
+	CONTINUE: CONTINUE,
+	FOR:      FOR,
+	IN:       IN,
+	WHILE:    WHILE,
 	FUNCTION: FUNCTION,
 	LET:      LET,
+	MATCH:    MATCH,
 	TRUE:     TRUE,
 	FALSE:    FALSE,
 	IF:       IF,
 	ELSE:     ELSE,
 	RETURN:   RETURN,
+	THROW:    THROW,
+	TRY:      TRY,
+	CATCH:    CATCH,
+	FINALLY:  FINALLY,
 }
 
 // LookupType returns the token type for the passed identifier.
@@ -90,17 +201,49 @@ func LookupType(ident string) Type {
 	return IDENT
 }
 
+// Binary operators follow Go's precedence, so bitwise operators bind as
+// tightly as the arithmetic operators they resemble.
 var precedences = map[Type]int{
-	EQUAL:     precedence.EQUALS,
-	NOT_EQUAL: precedence.EQUALS,
-	GT:        precedence.LESSGREATER,
-	LT:        precedence.LESSGREATER,
-	MINUS:     precedence.SUM,
-	PLUS:      precedence.SUM,
-	ASTERISK:  precedence.PRODUCT,
-	SLASH:     precedence.PRODUCT,
-	LPAREN:    precedence.CALL,
-	LBRACKET:  precedence.INDEX,
+	ASSIGN:             precedence.ASSIGN,
+	AMPERSAND_ASSIGN:   precedence.ASSIGN,
+	AND_NOT_ASSIGN:     precedence.ASSIGN,
+	ASTERISK_ASSIGN:    precedence.ASSIGN,
+	CARET_ASSIGN:       precedence.ASSIGN,
+	MINUS_ASSIGN:       precedence.ASSIGN,
+	PERCENT_ASSIGN:     precedence.ASSIGN,
+	PIPE_ASSIGN:        precedence.ASSIGN,
+	PLUS_ASSIGN:        precedence.ASSIGN,
+	POWER_ASSIGN:       precedence.ASSIGN,
+	SHIFT_LEFT_ASSIGN:  precedence.ASSIGN,
+	SHIFT_RIGHT_ASSIGN: precedence.ASSIGN,
+	SLASH_ASSIGN:       precedence.ASSIGN,
+	OR:                 precedence.OR,
+	AND:                precedence.AND,
+	EQUAL:              precedence.EQUALS,
+	NOT_EQUAL:          precedence.EQUALS,
+	GT:                 precedence.LESSGREATER,
+	GT_EQUAL:           precedence.LESSGREATER,
+	LT:                 precedence.LESSGREATER,
+	LT_EQUAL:           precedence.LESSGREATER,
+	CARET:              precedence.SUM,
+	MINUS:              precedence.SUM,
+	PIPE:               precedence.SUM,
+	PLUS:               precedence.SUM,
+	AMPERSAND:          precedence.PRODUCT,
+	AND_NOT:            precedence.PRODUCT,
+	ASTERISK:           precedence.PRODUCT,
+	PERCENT:            precedence.PRODUCT,
+	SHIFT_LEFT:         precedence.PRODUCT,
+	SHIFT_RIGHT:        precedence.PRODUCT,
+	SLASH:              precedence.PRODUCT,
+	POWER:              precedence.POWER,
+	LPAREN:             precedence.CALL,
+	LBRACKET:           precedence.INDEX,
+}
+
+// IsRightAssociative checks if this token is a right associative operator.
+func (t Token) IsRightAssociative() bool {
+	return t.Type == POWER
 }
 
 // Precedence returns the precedence of a token's type.